@@ -0,0 +1,134 @@
+package bugzilla
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Activity is a change in the history of a bug, as shown by
+// show_activity.cgi. Field is named as in the forms when known, with the
+// description shown by Bugzilla otherwise. AttachID is set for the changes
+// of attachments.
+type Activity struct {
+	Who      string    `json:"who"`
+	When     time.Time `json:"when"`
+	Field    string    `json:"field"`
+	AttachID int       `json:"attach_id,omitempty"`
+	Removed  string    `json:"removed"`
+	Added    string    `json:"added"`
+}
+
+// zoneOffsets has the offsets of the time zone abbreviations Bugzilla
+// shows in its pages. time.Parse() gives a zero offset to the ones it
+// doesn't know, as CET.
+var zoneOffsets = map[string]string{
+	"UTC": "+0000", "GMT": "+0000", "WET": "+0000", "WEST": "+0100", "BST": "+0100",
+	"CET": "+0100", "CEST": "+0200", "MET": "+0100", "MEST": "+0200",
+	"EET": "+0200", "EEST": "+0300", "MSK": "+0300", "JST": "+0900",
+	"EST": "-0500", "EDT": "-0400", "CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600", "PST": "-0800", "PDT": "-0700",
+}
+
+// parsePageTime reads the times shown in the web pages, which may have no
+// seconds. Times without a zone are taken as UTC, those with an unknown
+// zone abbreviation are refused.
+func parsePageTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if i := strings.LastIndex(raw, " "); i >= 0 {
+		zone := raw[i+1:]
+		if strings.IndexFunc(zone, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+			offset, ok := zoneOffsets[zone]
+			if !ok {
+				return time.Time{}, fmt.Errorf("invalid time %q: unknown time zone %s", raw, zone)
+			}
+			raw = raw[:i+1] + offset
+		}
+	}
+	layouts := []string{"2006-01-02 15:04:05 -0700", "2006-01-02 15:04 -0700",
+		"2006-01-02 15:04:05", "2006-01-02 15:04"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", raw)
+}
+
+func cellText(s *goquery.Selection) string {
+	return strings.TrimSpace(s.Text())
+}
+
+// parseActivity reads the table of show_activity.cgi, where the cells of
+// who and when span all the fields changed at once
+func parseActivity(p *page) ([]Activity, error) {
+	table := p.doc.Find("table").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return cellText(s.Find("th").First()) == "Who"
+	}).First()
+	if table.Length() == 0 {
+		if msg := cellText(p.doc.Find("#error_msg")); msg != "" {
+			return nil, ErrBugzilla{fmt.Errorf("%s", msg)}
+		}
+		if strings.Contains(p.doc.Text(), "No changes have been made to this bug yet.") {
+			return []Activity{}, nil
+		}
+		return nil, ErrBugzilla{fmt.Errorf("unexpected activity page: no changes table found")}
+	}
+
+	activity := []Activity{}
+	var who string
+	var when time.Time
+	var err error
+	table.Find("tr").EachWithBreak(func(i int, row *goquery.Selection) bool {
+		cells := row.Find("td")
+		var texts []string
+		cells.Each(func(i int, cell *goquery.Selection) {
+			texts = append(texts, cellText(cell))
+		})
+		switch len(texts) {
+		case 5:
+			who = texts[0]
+			if when, err = parsePageTime(texts[1]); err != nil {
+				err = ErrBugzilla{fmt.Errorf("unexpected activity page: %v", err)}
+				return false
+			}
+			texts = texts[2:]
+		case 3:
+		default:
+			return true
+		}
+		change := Activity{Who: who, When: when, Field: texts[0], Removed: texts[1], Added: texts[2]}
+		if match := attachmentFieldRe.FindStringSubmatch(change.Field); match != nil {
+			change.AttachID, _ = strconv.Atoi(match[1])
+			change.Field = match[2]
+			if change.Field == "is obsolete" {
+				change.Field = "isobsolete"
+			}
+		}
+		if field, ok := fieldDescriptions[change.Field]; ok {
+			change.Field = field
+		}
+		activity = append(activity, change)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// GetActivity fetches the history of changes of a bug, oldest first
+func (c *Client) GetActivity(id int) ([]Activity, error) {
+	url, err := c.getURL("show_activity.cgi", map[string]string{"id": strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.openPage(url)
+	if err != nil {
+		return nil, err
+	}
+	return parseActivity(p)
+}
@@ -0,0 +1,155 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+// aliasServer knows bugXml as CVE-2023-1234 and CVE-2023-1235. It is
+// Bugzilla 4.4.12 unless version is set.
+type aliasServer struct {
+	queries []url.Values
+	posts   []url.Values
+	alias   string
+	version string
+}
+
+func (as *aliasServer) handle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	as.queries = append(as.queries, query)
+	switch r.URL.Path {
+	case "/show_bug.cgi":
+		if query.Get("ctype") != "xml" {
+			io.WriteString(w, strings.Replace(showBugHtml, `name="alias" class="text_input"
+              value=""`, `name="alias" class="text_input"
+              value="`+as.alias+`"`, 1))
+			return
+		}
+		switch query.Get("id") {
+		case "1047068", "CVE-2023-1234", "CVE-2023-1235":
+			xml := strings.Replace(bugXml, "<bug_id>1047068</bug_id>",
+				"<bug_id>1047068</bug_id><alias>CVE-2023-1234</alias><alias>CVE-2023-1235</alias>", 1)
+			if as.version != "" {
+				xml = strings.Replace(xml, `version="4.4.12"`, `version="`+as.version+`"`, 1)
+			}
+			io.WriteString(w, xml)
+		case "CVE-2023-9999":
+			io.WriteString(w, `<?xml version="1.0"?><bugzilla version="4.4.12">
+<bug error="NotPermitted"><bug_id>CVE-2023-9999</bug_id></bug></bugzilla>`)
+		default:
+			io.WriteString(w, `<?xml version="1.0"?><bugzilla version="4.4.12">
+<bug error="InvalidBugId"><bug_id>`+query.Get("id")+`</bug_id></bug></bugzilla>`)
+		}
+	case "/process_bug.cgi":
+		r.ParseForm()
+		as.posts = append(as.posts, r.PostForm)
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestGetBugByAlias(c *C) {
+	as := &aliasServer{}
+	ts := httptest.NewServer(http.HandlerFunc(as.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	bug, err := bz.GetBugByAlias("CVE-2023-1234")
+	c.Assert(err, IsNil)
+	c.Assert(bug.BugID, Equals, 1047068)
+	c.Assert(bug.Alias, DeepEquals, []string{"CVE-2023-1234", "CVE-2023-1235"})
+	c.Assert(as.queries[0].Get("id"), Equals, "CVE-2023-1234")
+
+	bug, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Assert(bug.Alias, DeepEquals, []string{"CVE-2023-1234", "CVE-2023-1235"})
+}
+
+func (cs *clientSuite) TestGetBugByAliasErrors(c *C) {
+	as := &aliasServer{}
+	ts := httptest.NewServer(http.HandlerFunc(as.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	_, err := bz.GetBugByAlias("CVE-2023-0000")
+	c.Assert(err, DeepEquals, bugzilla.BugError{Alias: "CVE-2023-0000", Code: "NotFound"})
+	c.Assert(err, ErrorMatches, "cannot get bug CVE-2023-0000: NotFound")
+
+	_, err = bz.GetBugByAlias("CVE-2023-9999")
+	c.Assert(err, DeepEquals, bugzilla.BugError{Alias: "CVE-2023-9999", Code: "NotPermitted"})
+
+	_, err = bz.GetBugByAlias("1047068")
+	c.Assert(err, ErrorMatches, ".*aliases can't be numbers")
+	_, err = bz.GetBugByAlias("")
+	c.Assert(err, ErrorMatches, ".*empty alias")
+	c.Assert(as.queries, HasLen, 2)
+
+	// errors of GetBugs() still have the bug ID
+	_, bugErrors, err := bz.GetBugs([]int{1047069})
+	c.Assert(err, IsNil)
+	c.Assert(bugErrors, DeepEquals, []bugzilla.BugError{{ID: 1047069, Code: "InvalidBugId"}})
+}
+
+func (cs *clientSuite) TestUpdateAliases(c *C) {
+	as := &aliasServer{alias: "CVE-2023-1234, CVE-2023-1235", version: "5.0.6"}
+	ts := httptest.NewServer(http.HandlerFunc(as.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	_, err := bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1236", RemoveAlias: "CVE-2023-1234"})
+	c.Assert(err, IsNil)
+	c.Assert(as.posts[0].Get("alias"), Equals, "CVE-2023-1235, CVE-2023-1236")
+
+	// adding a present alias doesn't duplicate it
+	_, err = bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1235"})
+	c.Assert(err, IsNil)
+	c.Assert(as.posts[1].Get("alias"), Equals, "CVE-2023-1234, CVE-2023-1235")
+
+	as.alias = ""
+	_, err = bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1234"})
+	c.Assert(err, IsNil)
+	c.Assert(as.posts[2].Get("alias"), Equals, "CVE-2023-1234")
+}
+
+func (cs *clientSuite) TestUpdateAliasesBugzilla4(c *C) {
+	as := &aliasServer{alias: "CVE-2023-1234"}
+	ts := httptest.NewServer(http.HandlerFunc(as.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	// Bugzilla 4.4 has room for a single alias
+	_, err := bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1235"})
+	c.Assert(err, ErrorMatches, "cannot build request: cannot set the aliases CVE-2023-1234, CVE-2023-1235: "+
+		"Bugzilla 4.4.12 allows only one alias per bug, several need Bugzilla 5")
+	c.Assert(as.posts, HasLen, 0)
+
+	// replacing it works, and the version is only looked up once
+	_, err = bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1235", RemoveAlias: "CVE-2023-1234"})
+	c.Assert(err, IsNil)
+	c.Assert(as.posts, HasLen, 1)
+	c.Assert(as.posts[0].Get("alias"), Equals, "CVE-2023-1235")
+	_, err = bz.Update(1047068, bugzilla.Changes{AddAlias: "CVE-2023-1236"})
+	c.Assert(err, NotNil)
+	var versions int
+	for _, query := range as.queries {
+		if query.Get("ctype") == "xml" {
+			versions++
+		}
+	}
+	c.Assert(versions, Equals, 1)
+}
+
+func (cs *clientSuite) TestDiffAliases(c *C) {
+	old := &bugzilla.Bug{BugID: 1047068, Alias: []string{"CVE-2023-1234"}}
+	bug := &bugzilla.Bug{BugID: 1047068, Alias: []string{"CVE-2023-1234", "CVE-2023-1235"}}
+	c.Assert(bugzilla.Diff(old, bug).Lists, DeepEquals, []bugzilla.ListChange{
+		{Field: "alias", Removed: []string{}, Added: []string{"CVE-2023-1235"}},
+	})
+}
@@ -0,0 +1,125 @@
+package bugzilla
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// APIKeyHeader is the header used to send Config.APIKey
+const APIKeyHeader = "X-BUGZILLA-API-KEY"
+
+const redacted = "[REDACTED]"
+
+// ErrAPIKeyNotAccepted is returned when Bugzilla answers as to an
+// anonymous user, or with the login form, a Client whose only credential
+// is the API key: stock Bugzilla only takes API keys in the WebService, not
+// in pages such as show_bug.cgi, buglist.cgi and process_bug.cgi, which
+// then need a Password. Reading them anonymously would silently leave out
+// the private bugs and fields.
+var ErrAPIKeyNotAccepted = ErrBugzilla{errors.New("API key not accepted by the web pages: Bugzilla answered as to an anonymous user")}
+
+// redact removes the API key and the password from s
+func (c *Client) redact(s string) string {
+	for _, secret := range []string{c.Config.APIKey, c.Config.Password} {
+		if len(secret) > 0 {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
+
+func (c *Client) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if clean := c.redact(message); clean != message {
+		return errors.New(clean)
+	}
+	return err
+}
+
+// useBasicAuth tells whether the credentials are sent with HTTP Basic auth,
+// which is not the case when logging in with the form or when an API key
+// is used without a password
+func (config *Config) useBasicAuth() bool {
+	return !config.FormLogin && !(config.APIKey != "" && config.Password == "")
+}
+
+// apiKeyOnly tells whether the API key is the only credential sent
+func (config *Config) apiKeyOnly() bool {
+	return !config.FormLogin && config.APIKey != "" && config.Password == ""
+}
+
+var bugzillaXMLRe = regexp.MustCompile(`<bugzilla\s[^>]*>`)
+
+// isAnonymousPage tells whether body was served to an anonymous user, and
+// whether that can be told at all: the XML of show_bug.cgi names the user
+// as exporter, and the HTML pages of anonymous users have a login link or
+// form. The CSV and RDF formats have nothing to tell.
+func isAnonymousPage(body []byte) (anonymous bool, known bool) {
+	if root := bugzillaXMLRe.Find(body); root != nil {
+		return !bytes.Contains(root, []byte(" exporter=")), true
+	}
+	if bytes.Contains(bytes.ToLower(body), []byte("<html")) {
+		return isLoginPage(body) || bytes.Contains(body, []byte("GoAheadAndLogIn")), true
+	}
+	return false, false
+}
+
+// checkAPIKeyAccepted fails with ErrAPIKeyNotAccepted when Bugzilla
+// answered as to an anonymous user a Client that only has an API key. When
+// body can't tell, the front page is checked, once per Client.
+func (c *Client) checkAPIKeyAccepted(body []byte) error {
+	if !c.Config.apiKeyOnly() {
+		return nil
+	}
+	anonymous, known := isAnonymousPage(body)
+	if known {
+		if anonymous {
+			return ErrAPIKeyNotAccepted
+		}
+		return nil
+	}
+
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	if c.apiKeyChecked {
+		return nil
+	}
+	url, err := c.getURL("index.cgi", nil)
+	if err != nil {
+		return err
+	}
+	front, err := c.fetch(url)
+	if err != nil {
+		return err
+	}
+	if anonymous, _ := isAnonymousPage(front); anonymous {
+		return ErrAPIKeyNotAccepted
+	}
+	c.apiKeyChecked = true
+	return nil
+}
+
+// String hides the password and the API key when the Config is printed
+func (config Config) String() string {
+	hide := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	return fmt.Sprintf("{BaseURL:%s User:%s Password:%s APIKey:%s FormLogin:%v "+
+		"TLS:%+v ProxyURL:%s Timeout:%v DialTimeout:%v UserAgent:%q}",
+		config.BaseURL, config.User, hide(config.Password), hide(config.APIKey), config.FormLogin,
+		config.TLS, redactURL(config.ProxyURL), config.Timeout, config.DialTimeout, config.UserAgent)
+}
+
+// GoString works as String for the %#v verb
+func (config Config) GoString() string {
+	return "bugzilla.Config" + config.String()
+}
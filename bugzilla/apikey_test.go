@@ -0,0 +1,175 @@
+package bugzilla_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const testAPIKey = "xVBnpgOsrOnRDaWcxmB9Fcy2fQ6cX3mOVdySGbTo"
+
+func makeAPIKeyClient(url string) *bugzilla.Client {
+	config := bugzilla.Config{BaseURL: url, User: "me", APIKey: testAPIKey}
+	bz, _ := bugzilla.New(config)
+	return bz
+}
+
+func (cs *clientSuite) TestAPIKeyHeader(c *C) {
+	var headers []http.Header
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			if r.URL.Query().Get("ctype") == "xml" {
+				io.WriteString(w, bugXml)
+				return
+			}
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+
+	bz := makeAPIKeyClient(ts0.URL)
+	_, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, IsNil)
+
+	c.Assert(headers, HasLen, 3)
+	for _, header := range headers {
+		c.Check(header.Get("X-Bugzilla-Api-Key"), Equals, testAPIKey)
+		c.Check(header.Get("Authorization"), Equals, "")
+	}
+}
+
+func (cs *clientSuite) TestAPIKeyUpdateRejected(c *C) {
+	// a server that accepts the key in show_bug.cgi?ctype=xml but not in
+	// the forms
+	formLogin := true
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			if r.URL.Query().Get("ctype") == "xml" {
+				io.WriteString(w, bugXml)
+			} else if formLogin {
+				io.WriteString(w, loginPage)
+			} else {
+				io.WriteString(w, showBugHtml)
+			}
+		case "/process_bug.cgi":
+			io.WriteString(w, loginPage)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+
+	bz := makeAPIKeyClient(ts0.URL)
+	_, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, Equals, bugzilla.ErrAPIKeyNotAccepted)
+	c.Check(err, ErrorMatches, ".*API key not accepted by the web pages.*")
+
+	formLogin = false
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, Equals, bugzilla.ErrAPIKeyNotAccepted)
+}
+
+func (cs *clientSuite) TestAPIKeyJSONRPC(c *C) {
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.RawQuery, Equals, "")
+		var call struct {
+			Method string
+			Params []map[string]interface{}
+		}
+		err := json.NewDecoder(r.Body).Decode(&call)
+		c.Assert(err, IsNil)
+		c.Check(call.Params[0]["Bugzilla_api_key"], Equals, testAPIKey)
+		c.Check(call.Params[0]["names"], DeepEquals, []interface{}{"bug_status"})
+		// servers may echo the key back in error messages
+		fmt.Fprintf(w, `{"result": null, "error": {"message": "The API key %s is invalid", "code": 306}, "id": 1}`, testAPIKey)
+	}))
+	defer ts0.Close()
+
+	bz := makeAPIKeyClient(ts0.URL)
+	_, err := bz.GetWorkflow()
+	c.Assert(err, NotNil)
+	c.Check(err, ErrorMatches, `.*The API key \[REDACTED\] is invalid \(code 306\).*`)
+}
+
+func (cs *clientSuite) TestAPIKeyRedacted(c *C) {
+	config := bugzilla.Config{BaseURL: "http://localhost/", User: "me",
+		Password: "letmein", APIKey: testAPIKey}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		printed := fmt.Sprintf(format, config)
+		c.Check(printed, Not(Matches), ".*"+testAPIKey+".*")
+		c.Check(printed, Not(Matches), ".*letmein.*")
+		c.Check(printed, Matches, ".*APIKey:\\[REDACTED\\].*")
+	}
+
+	// the key is never part of a URL, so connection errors can't leak it
+	bz := makeAPIKeyClient("http://127.0.0.1:1/")
+	_, err := bz.GetWorkflow()
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Not(Matches), ".*"+testAPIKey+".*")
+}
+
+func (cs *clientSuite) TestAPIKeyReadRejected(c *C) {
+	// stock Bugzilla serves the pages as to an anonymous user
+	loggedIn := false
+	var fronts int
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			if loggedIn {
+				io.WriteString(w, bugXml)
+			} else {
+				io.WriteString(w, strings.Replace(bugXml, `exporter="username@foobar.com"`, "", 1))
+			}
+		case "/buglist.cgi":
+			io.WriteString(w, "bug_id,\"changeddate\"\n1047068,\"2019-03-27 10:45:20\"\n")
+		case "/index.cgi":
+			fronts++
+			if loggedIn {
+				io.WriteString(w, `<html><body><a href="index.cgi?logout=1">Log out</a></body></html>`)
+			} else {
+				io.WriteString(w, `<html><body><a id="login_link_top" href="index.cgi?GoAheadAndLogIn=1">Log In</a></body></html>`)
+			}
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+
+	rules, err := bugzilla.LoadRules(strings.NewReader(`{"rules": [{"name": "x",
+		"query": {"product": "Frob"}, "actions": {"add_cc": "a@b.c"}}]}`))
+	c.Assert(err, IsNil)
+
+	bz := makeAPIKeyClient(ts0.URL)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, Equals, bugzilla.ErrAPIKeyNotAccepted)
+	// the CSV of searches can't tell, the front page is checked instead
+	_, err = bz.RunRules(rules, bugzilla.RuleOptions{DryRun: true})
+	c.Assert(err, Equals, bugzilla.ErrAPIKeyNotAccepted)
+
+	loggedIn = true
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	for i := 0; i < 2; i++ {
+		actions, err := bz.RunRules(rules, bugzilla.RuleOptions{DryRun: true})
+		c.Assert(err, IsNil)
+		c.Assert(actions, HasLen, 1)
+	}
+	c.Check(fronts, Equals, 2)
+}
@@ -0,0 +1,320 @@
+package bugzilla
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bugmail is a notification email sent by Bugzilla. Headers has all the
+// X-Bugzilla-* headers, without the prefix, as in "Reason" or "Who".
+// Events has the changes described in the email: one for each row of
+// the "What | Removed | Added" table, then the attachments and comments
+// that were added, as Watcher would send them.
+type Bugmail struct {
+	BugID        int
+	Subject      string
+	Date         time.Time
+	Type         string
+	Who          string
+	Reasons      []string
+	WatchReasons []string
+	Headers      map[string]string
+	Events       []Event
+}
+
+var (
+	bugmailSubjectRe = regexp.MustCompile(`\[Bug (\d+)\]`)
+	bugmailURLRe     = regexp.MustCompile(`show_bug\.cgi\?id=(\d+)`)
+	bugmailCommentRe = regexp.MustCompile(`^--- Comment #(\d+) from (.*?)(?: \d{4}-\d\d-\d\d [\d:]+ \w+)? ---$`)
+	bugmailCreatedRe = regexp.MustCompile(`^Created attachment (\d+)`)
+)
+
+// ParseBugmail reads a notification email sent by Bugzilla, so that it can
+// be acted upon without fetching the bug. Only the first table of changes
+// is read: the others are about the bugs it depends on.
+func ParseBugmail(source io.Reader) (*Bugmail, error) {
+	msg, err := mail.ReadMessage(source)
+	if err != nil {
+		return nil, ErrBugzilla{fmt.Errorf("failed to parse the bugmail: %v", err)}
+	}
+	bugmail := &Bugmail{Headers: make(map[string]string)}
+	for key, values := range msg.Header {
+		if strings.HasPrefix(key, "X-Bugzilla-") && len(values) > 0 {
+			bugmail.Headers[strings.TrimPrefix(key, "X-Bugzilla-")] = values[0]
+		}
+	}
+	if len(bugmail.Headers) == 0 {
+		return nil, ErrBugzilla{fmt.Errorf("not a bugmail: no X-Bugzilla headers found")}
+	}
+	bugmail.Type = bugmail.Headers["Type"]
+	bugmail.Who = bugmail.Headers["Who"]
+	bugmail.Reasons = bugmailReasons(bugmail.Headers["Reason"])
+	bugmail.WatchReasons = bugmailReasons(bugmail.Headers["Watch-Reason"])
+	bugmail.Date, _ = msg.Header.Date()
+
+	subject := msg.Header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	bugmail.Subject = subject
+
+	text, err := bugmailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, ErrBugzilla{fmt.Errorf("failed to read the bugmail: %v", err)}
+	}
+
+	match := bugmailSubjectRe.FindStringSubmatch(subject)
+	if match == nil {
+		match = bugmailURLRe.FindStringSubmatch(text)
+	}
+	if match == nil {
+		return nil, ErrBugzilla{fmt.Errorf("not a bugmail: no bug id found")}
+	}
+	bugmail.BugID, _ = strconv.Atoi(match[1])
+
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	bugmail.Events = append(bugmail.parseTable(lines), bugmail.parseComments(lines)...)
+	return bugmail, nil
+}
+
+func bugmailReasons(header string) []string {
+	reasons := []string{}
+	for _, reason := range strings.Fields(header) {
+		if reason != "None" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// bugmailText finds the plain text of the email, which can be alone or
+// along with an HTML version
+func bugmailText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return "", fmt.Errorf("no plain text part found")
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := bugmailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("unexpected content type %s", mediaType)
+	}
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	b, err := ioutil.ReadAll(body)
+	return string(b), err
+}
+
+// tableRow is a row of the table of changes, which can span several lines
+// of text when the values are too long for their columns
+type tableRow struct {
+	what, removed, added []string
+}
+
+func columns(line []rune, first, second int) (what, removed, added string) {
+	cut := func(from, to int) string {
+		if from > len(line) {
+			return ""
+		}
+		if to > len(line) || to < 0 {
+			to = len(line)
+		}
+		return strings.TrimSpace(string(line[from:to]))
+	}
+	return cut(0, first), cut(first+1, second), cut(second+1, -1)
+}
+
+func (b *Bugmail) parseTable(lines []string) []Event {
+	start := -1
+	for i, line := range lines {
+		fields := strings.Split(line, "|")
+		if len(fields) == 3 && strings.TrimSpace(fields[0]) == "What" &&
+			strings.TrimSpace(fields[1]) == "Removed" && strings.TrimSpace(fields[2]) == "Added" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	var pipes []int
+	for i, r := range []rune(lines[start]) {
+		if r == '|' {
+			pipes = append(pipes, i)
+		}
+	}
+	first, second := pipes[0], pipes[1]
+
+	var rows []*tableRow
+	for _, line := range lines[start+1:] {
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		if strings.Trim(line, "-") == "" || !strings.Contains(line, "|") {
+			continue
+		}
+		what, removed, added := columns([]rune(line), first, second)
+		last := len(rows) - 1
+		switch {
+		case what == "" && last >= 0:
+			rows[last].removed = append(rows[last].removed, removed)
+			rows[last].added = append(rows[last].added, added)
+		case removed == "" && added == "" && last >= 0:
+			rows[last].what = append(rows[last].what, what)
+		default:
+			rows = append(rows, &tableRow{[]string{what}, []string{removed}, []string{added}})
+		}
+	}
+
+	var events []Event
+	for _, row := range rows {
+		events = append(events, b.rowEvents(row)...)
+	}
+	return events
+}
+
+func joinColumn(pieces []string) string {
+	var nonEmpty []string
+	for _, piece := range pieces {
+		if piece != "" {
+			nonEmpty = append(nonEmpty, piece)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+func (b *Bugmail) event(kind EventKind) Event {
+	return Event{Kind: kind, BugID: b.BugID, When: b.Date, Who: b.Who}
+}
+
+// rowEvents turns a row of the table into events
+func (b *Bugmail) rowEvents(row *tableRow) []Event {
+	what := joinColumn(row.what)
+	removed, added := joinColumn(row.removed), joinColumn(row.added)
+
+	var attachment *Attachment
+	if match := attachmentFieldRe.FindStringSubmatch(what); match != nil {
+		id, _ := strconv.Atoi(match[1])
+		attachment = &Attachment{AttachID: id}
+		what = match[2]
+		if what == "is obsolete" {
+			what = "isobsolete"
+		}
+	}
+
+	field, ok := fieldDescriptions[what]
+	if !ok {
+		field = what
+	}
+	return changeEvents(b.event(EventField), field, removed, added, attachment)
+}
+
+// parseComments reads the comments added, which start with a line such as
+// "--- Comment #5 from Firstname Lastname <user@foobar.com> ---" and end
+// with the next one or with the signature
+func (b *Bugmail) parseComments(lines []string) []Event {
+	var events []Event
+	var comment *Comment
+	var text []string
+	flush := func() {
+		if comment == nil {
+			return
+		}
+		comment.TheText = strings.TrimRight(strings.Join(text, "\n"), "\n ")
+		e := b.event(EventComment)
+		e.Who, e.Comment = comment.Who.Email, comment
+		events = append(events, b.createdAttachments(comment)...)
+		events = append(events, e)
+		comment, text = nil, nil
+	}
+	for _, line := range lines {
+		if match := bugmailCommentRe.FindStringSubmatch(line); match != nil {
+			flush()
+			count, _ := strconv.Atoi(match[1])
+			comment = &Comment{Count: count, BugWhen: b.Date, Who: parseUser(match[2])}
+			continue
+		}
+		if line == "-- " {
+			flush()
+			break
+		}
+		if comment != nil {
+			text = append(text, line)
+		}
+	}
+	flush()
+	return events
+}
+
+// parseUser reads a user shown as in "Firstname Lastname <user@foobar.com>"
+func parseUser(text string) User {
+	address, err := mail.ParseAddress(text)
+	if err != nil {
+		// names such as "Lastname, Firstname" are not quoted
+		if open := strings.LastIndex(text, "<"); open >= 0 && strings.HasSuffix(text, ">") {
+			return User{Name: strings.TrimSpace(text[:open]), Email: text[open+1 : len(text)-1]}
+		}
+		return User{Email: text}
+	}
+	return User{Name: address.Name, Email: address.Address}
+}
+
+// createdAttachments finds the attachments added with comment, which
+// starts as in:
+//
+//	Created attachment 800
+//	  --> https://bugzilla.suse.com/attachment.cgi?id=800&action=edit
+//	description
+func (b *Bugmail) createdAttachments(comment *Comment) []Event {
+	scanner := bufio.NewScanner(strings.NewReader(comment.TheText))
+	if !scanner.Scan() {
+		return nil
+	}
+	match := bugmailCreatedRe.FindStringSubmatch(scanner.Text())
+	if match == nil {
+		return nil
+	}
+	id, _ := strconv.Atoi(match[1])
+	attachment := &Attachment{AttachID: id, Date: b.Date,
+		Attacher: comment.Who}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "-->") {
+			continue
+		}
+		attachment.Desc = line
+		break
+	}
+	e := b.event(EventAttachment)
+	e.Who, e.Attachment = comment.Who.Email, attachment
+	return []Event{e}
+}
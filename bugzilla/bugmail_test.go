@@ -0,0 +1,142 @@
+package bugzilla_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+var sampleBugmail = strings.Replace(`Return-Path: <bugzilla_noreply@suse.com>
+From: bugzilla_noreply@suse.com
+To: user@foobar.com
+Subject: [Bug 1047068] L4: test cloud bug
+Date: Wed, 27 Mar 2019 10:45:20 +0000
+X-Bugzilla-Reason: CC AssignedTo
+X-Bugzilla-Type: changed
+X-Bugzilla-Watch-Reason: None
+X-Bugzilla-Product: foobar Frobnicator Cloud 7
+X-Bugzilla-Component: Frobtool
+X-Bugzilla-Who: other@foobar.com
+X-Bugzilla-Status: RESOLVED
+X-Bugzilla-Resolution: FIXED
+X-Bugzilla-Changed-Fields: bug_status resolution cc flagtypes.name attachments.isobsolete
+Message-ID: <bug-1047068-1234-abcdef@http.bugzilla.suse.com/>
+Content-Type: text/plain; charset="UTF-8"
+Content-Transfer-Encoding: quoted-printable
+MIME-Version: 1.0
+
+http://bugzilla.suse.com/show_bug.cgi?id=3D1047068
+http://bugzilla.suse.com/show_bug.cgi?id=3D1047068#c5
+
+Other User <other@foobar.com> changed:
+
+           What    |Removed                     |Added
+----------------------------------------------------------------------------
+             Status|NEW                         |RESOLVED
+         Resolution|---                         |FIXED
+                 CC|user@foobar.com             |new@foobar.com,
+                   |                            |another@foobar.com
+              Flags|needinfo?(other@foobar.com) |SHIP_STOPPER+
+ Attachment #800 is|0                           |1
+           obsolete|                            |
+
+--- Comment #5 from Other User <other@foobar.com> ---
+Created attachment 801
+  --> http://bugzilla.suse.com/attachment.cgi?id=3D801&action=3Dedit
+the fixed patch
+
+Fixed with the new patch, sorry for the w=
+ait.
+
+--- Comment #6 from Other User <other@foobar.com> ---
+Also closing.
+
+--=20
+You are receiving this mail because:
+You are on the CC list for the bug.
+You are the assignee for the bug.
+`, "\n", "\r\n", -1)
+
+func (cs *clientSuite) TestParseBugmail(c *C) {
+	bugmail, err := bugzilla.ParseBugmail(strings.NewReader(sampleBugmail))
+	c.Assert(err, IsNil)
+	c.Assert(bugmail.BugID, Equals, 1047068)
+	c.Assert(bugmail.Subject, Equals, "[Bug 1047068] L4: test cloud bug")
+	c.Assert(bugmail.Type, Equals, "changed")
+	c.Assert(bugmail.Who, Equals, "other@foobar.com")
+	c.Assert(bugmail.Reasons, DeepEquals, []string{"CC", "AssignedTo"})
+	c.Assert(bugmail.WatchReasons, DeepEquals, []string{})
+	c.Assert(bugmail.Headers["Product"], Equals, "foobar Frobnicator Cloud 7")
+	c.Assert(bugmail.Date.Equal(time.Date(2019, 3, 27, 10, 45, 20, 0, time.UTC)), Equals, true)
+
+	c.Assert(eventSummaries(bugmail.Events), DeepEquals, []string{
+		`bug 1047068: bug_status: "NEW" -> "RESOLVED"`,
+		`bug 1047068: resolution: "" -> "FIXED"`,
+		`bug 1047068: cc: "user@foobar.com" -> "new@foobar.com, another@foobar.com"`,
+		`bug 1047068: needinfo: "needinfo?(other@foobar.com)" -> ""`,
+		`bug 1047068: SHIP_STOPPER: "" -> "SHIP_STOPPER+"`,
+		`bug 1047068: attachment 800: isobsolete: "0" -> "1"`,
+		`bug 1047068: attachment 801 (the fixed patch) by other@foobar.com`,
+		`bug 1047068: comment 5 by other@foobar.com`,
+		`bug 1047068: comment 6 by other@foobar.com`,
+	})
+
+	events := bugmail.Events
+	c.Assert(events[0].Kind, Equals, bugzilla.EventStatus)
+	c.Assert(events[2].Kind, Equals, bugzilla.EventField)
+	c.Assert(events[3].Kind, Equals, bugzilla.EventFlag)
+	c.Assert(events[3].Flag.Requestee, Equals, "other@foobar.com")
+	c.Assert(events[4].Flag.Setter, Equals, "other@foobar.com")
+	c.Assert(events[5].Kind, Equals, bugzilla.EventAttachment)
+	c.Assert(events[7].Comment.Who.Name, Equals, "Other User")
+	c.Assert(events[7].Comment.TheText, Equals, `Created attachment 801
+  --> http://bugzilla.suse.com/attachment.cgi?id=801&action=edit
+the fixed patch
+
+Fixed with the new patch, sorry for the wait.`)
+	c.Assert(events[8].Comment.TheText, Equals, "Also closing.")
+}
+
+func (cs *clientSuite) TestParseBugmailMultipart(c *C) {
+	mail := `From: bugzilla_noreply@suse.com
+Subject: =?UTF-8?Q?[Bug_1047068]_L4:_test_cloud_bug_=E2=80=94_again?=
+Date: Wed, 27 Mar 2019 10:45:20 +0000
+X-Bugzilla-Type: changed
+X-Bugzilla-Who: other@foobar.com
+X-Bugzilla-Reason: None
+X-Bugzilla-Watch-Reason: Component-Watcher
+Content-Type: multipart/alternative; boundary="boundary"
+MIME-Version: 1.0
+
+--boundary
+Content-Type: text/plain; charset="UTF-8"
+
+Other User <other@foobar.com> changed:
+
+           What    |Removed                     |Added
+----------------------------------------------------------------------------
+           Priority|P5 - None                   |P2 - High
+
+--boundary
+Content-Type: text/html; charset="UTF-8"
+
+<html><body>ignored</body></html>
+--boundary--
+`
+	bugmail, err := bugzilla.ParseBugmail(strings.NewReader(mail))
+	c.Assert(err, IsNil)
+	c.Assert(bugmail.Subject, Equals, "[Bug 1047068] L4: test cloud bug — again")
+	c.Assert(bugmail.Reasons, DeepEquals, []string{})
+	c.Assert(bugmail.WatchReasons, DeepEquals, []string{"Component-Watcher"})
+	c.Assert(eventSummaries(bugmail.Events), DeepEquals, []string{
+		`bug 1047068: priority: "P5 - None" -> "P2 - High"`,
+	})
+}
+
+func (cs *clientSuite) TestParseBugmailInvalid(c *C) {
+	_, err := bugzilla.ParseBugmail(strings.NewReader("Subject: hello\n\nnot from Bugzilla\n"))
+	c.Assert(err, ErrorMatches, ".*not a bugmail: no X-Bugzilla headers found")
+	c.Assert(err, FitsTypeOf, bugzilla.ErrBugzilla{})
+}
@@ -9,18 +9,18 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"mime"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/headzoo/surf"
-	"github.com/headzoo/surf/browser"
 )
 
 // RequestError happens when building the request
@@ -37,6 +37,18 @@ func (e ConnectionError) Error() string {
 	return fmt.Sprintf("cannot communicate with server: %v", e.error)
 }
 
+// InvalidValueError happens when a change sets a field to a value that is
+// not legal for it, according to the configuration of Bugzilla or to the
+// options of the bug form
+type InvalidValueError struct {
+	Field string
+	Value string
+}
+
+func (e InvalidValueError) Error() string {
+	return fmt.Sprintf("invalid %s value: %v", e.Field, e.Value)
+}
+
 // Cacher should be anything that takes the name of the object to be cached
 // and returns something that can receive writes with the contents and then
 // eventually be closed.
@@ -45,20 +57,67 @@ type Cacher interface {
 }
 
 // Config sets the parameters needed to set up the client. Cacher can be
-// left zeroed.
+// left zeroed. When FormLogin is set, User and Password are sent to the
+// Bugzilla login form and the session cookies are used instead of HTTP
+// Basic auth. APIKey is sent in the X-BUGZILLA-API-KEY header and to the
+// WebService; Password can be left empty when it is set, but stock
+// Bugzilla ignores the header in the web pages, and then both reads and
+// Update() fail with ErrAPIKeyNotAccepted. SessionStore keeps the session of FormLogin
+// between runs, and defaults to a FileSessionStore.
+//
+// The requests go through Transport, or the transport of HTTPClient, when
+// set. Otherwise a copy of http.DefaultTransport is configured with TLS,
+// ProxyURL and DialTimeout (which also limits the TLS handshake). Timeout
+// limits each whole request and defaults to the one of HTTPClient.
+// UserAgent replaces the default User-Agent header.
 type Config struct {
-	BaseURL  string
-	User     string
-	Password string
-	Cacher   Cacher
+	BaseURL      string
+	User         string
+	Password     string
+	APIKey       string
+	Cacher       Cacher
+	FormLogin    bool
+	SessionStore SessionStore
+
+	HTTPClient  *http.Client
+	Transport   http.RoundTripper
+	TLS         TLSConfig
+	ProxyURL    string
+	Timeout     time.Duration
+	DialTimeout time.Duration
+	UserAgent   string
 }
 
-// Client keeps the state of the client.
+// Client keeps the state of the client. A Client is safe for concurrent
+// use by multiple goroutines: every call works on its own pages and forms,
+// sharing only the cookies, the transport and the loaded configuration and
+// workflow. The Cacher, when set, must then be safe for concurrent use as
+// well. Config must not be changed after New().
 type Client struct {
 	Config        Config
-	browser       *browser.Browser
 	seriousClient *http.Client
+	jar           http.CookieJar
 	cacher        Cacher
+
+	// mu protects configuration, workflow and version, the version of
+	// Bugzilla
+	mu            sync.RWMutex
+	configuration *Configuration
+	workflow      *Workflow
+	version       string
+
+	// loginMu avoids logging in several times at once. loginGeneration
+	// counts the logins, so that the requests finding the same expired
+	// session log in again only once, and loginCookies are the cookies of
+	// the last one.
+	loginMu         sync.Mutex
+	loginGeneration int
+	loginCookies    []SessionCookie
+	// sessionErr is the last error of Config.SessionStore
+	sessionErr error
+	// apiKeyChecked is set once the front page showed that the API key
+	// is accepted by the web pages
+	apiKeyChecked bool
 }
 
 func getAuth(config *Config) string {
@@ -67,27 +126,50 @@ func getAuth(config *Config) string {
 	return auth
 }
 
-func getBrowser(config *Config) *browser.Browser {
-	browser := surf.NewBrowser()
-	browser.AddRequestHeader("Authorization", getAuth(config))
-
-	return browser
+func getDecentHTTPClient(config *Config, jar http.CookieJar, rt http.RoundTripper) *http.Client {
+	client := http.Client{Transport: rt, Jar: jar, Timeout: config.timeout()}
+	if config.HTTPClient != nil {
+		client.CheckRedirect = config.HTTPClient.CheckRedirect
+	}
+	return &client
 }
 
-func getDecentHTTPClient(config *Config) *http.Client {
-	tr := http.DefaultClient.Transport
-	client := http.Client{Transport: tr}
+// getRoundTripper adds the authentication and User-Agent headers to the
+// transport of the Config, so that both HTTP clients send the same ones
+func getRoundTripper(config *Config) (http.RoundTripper, error) {
+	tr, err := config.transport()
+	if err != nil {
+		return nil, RequestError{err}
+	}
 	rt := useHeader(tr)
-	rt.Set("Authorization", getAuth(config))
-	client.Transport = rt
-	return &client
+	if config.useBasicAuth() {
+		rt.Set("Authorization", getAuth(config))
+	}
+	if config.APIKey != "" {
+		rt.Set(APIKeyHeader, config.APIKey)
+	}
+	if config.UserAgent != "" {
+		rt.Set("User-Agent", config.UserAgent)
+	}
+	return rt, nil
 }
 
 // New prepares a *Client for connecting to the Bugzilla Web interface
 func New(config Config) (*Client, error) {
-	browser := getBrowser(&config)
-	seriousClient := getDecentHTTPClient(&config)
-	client := &Client{Config: config, browser: browser, seriousClient: seriousClient, cacher: config.Cacher}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	rt, err := getRoundTripper(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.FormLogin && config.SessionStore == nil {
+		config.SessionStore = &FileSessionStore{}
+	}
+	seriousClient := getDecentHTTPClient(&config, jar, rt)
+	client := &Client{Config: config, seriousClient: seriousClient, jar: jar, cacher: config.Cacher}
+	client.restoreSession()
 	return client, nil
 }
 
@@ -112,16 +194,15 @@ func (h withHeader) RoundTrip(req *http.Request) (*http.Response, error) {
 	return h.rt.RoundTrip(req)
 }
 
-func (c *Client) getShowBugURL(id int, values map[string]string) (string, error) {
+func (c *Client) getURL(script string, values map[string]string) (string, error) {
 	url, err := url.Parse(c.Config.BaseURL)
 	if err != nil {
 		return "", RequestError{err}
 	}
 
-	url.Path = path.Join(url.Path, "show_bug.cgi")
+	url.Path = path.Join(url.Path, script)
 
 	query := url.Query()
-	query.Set("id", fmt.Sprintf("%d", id))
 	for k, v := range values {
 		query.Set(k, v)
 	}
@@ -130,6 +211,14 @@ func (c *Client) getShowBugURL(id int, values map[string]string) (string, error)
 	return url.String(), nil
 }
 
+func (c *Client) getShowBugURL(id int, values map[string]string) (string, error) {
+	query := map[string]string{"id": fmt.Sprintf("%d", id)}
+	for k, v := range values {
+		query[k] = v
+	}
+	return c.getURL("show_bug.cgi", query)
+}
+
 func (c *Client) getDownloadURL(id int) (string, error) {
 	url, err := url.Parse(c.Config.BaseURL)
 	if err != nil {
@@ -177,6 +266,7 @@ type Bug struct {
 	Groups []Group `xml:"group" json:"group"`
 
 	BugID              int       `xml:"bug_id" json:"bug_id"`                           // 1047068
+	Alias              []string  `xml:"alias" json:"alias"`                             // CVE-2023-1234
 	CreationTS         time.Time `json:"creation_ts"`                                   // 2017-07-03 13:29:00 +0000
 	ShortDesc          string    `xml:"short_desc" json:"short_desc"`                   // L4: test cloud bug
 	DeltaTS            time.Time `json:"delta_ts"`                                      // 2019-03-27 10:45:20 +0000
@@ -186,13 +276,15 @@ type Bug struct {
 	Classification     string    `xml:"classification" json:"classification"`           // foobar Frobnicator Cloud
 	Product            string    `xml:"product" json:"product"`                         // foobar Frobnicator Cloud 7
 	Component          string    `xml:"component" json:"component"`                     // Frobtool
-	Platform           string    `xml:"platform" json:"platform"`                     
-	Version            string    `xml:"version" json:"version"`                         // Milestone 8
-	RepPlatform        string    `xml:"rep_platform" json:"rep_platform"`               // Other
-	OpSys              string    `xml:"op_sys" json:"op_sys"`                           // Other
-	BugStatus          string    `xml:"bug_status" json:"bug_status"`                   // RESOLVED
-	Resolution         string    `xml:"resolution" json:"resolution"`                   // FIXED
+	Platform           string    `xml:"platform" json:"platform"`
+	Version            string    `xml:"version" json:"version"`           // Milestone 8
+	RepPlatform        string    `xml:"rep_platform" json:"rep_platform"` // Other
+	OpSys              string    `xml:"op_sys" json:"op_sys"`             // Other
+	BugStatus          string    `xml:"bug_status" json:"bug_status"`     // RESOLVED
+	Resolution         string    `xml:"resolution" json:"resolution"`     // FIXED
 	DupID              int       `xml:"dup_id" json:"dup_id"`
+	DependsOn          []int     `xml:"dependson" json:"dependson"`
+	Blocks             []int     `xml:"blocked" json:"blocked"`
 
 	BugFileLoc       string `xml:"bug_file_loc" json:"bug_file_loc"`           //
 	StatusWhiteboard string `xml:"status_whiteboard" json:"status_whiteboard"` // wasL3:48626  zzz
@@ -201,11 +293,12 @@ type Bug struct {
 	BugSeverity      string `xml:"bug_severity" json:"bug_severity"`           // Normal
 	TargetMilestone  string `xml:"target_milestone" json:"target_milestone"`   // ---
 
-	EverConfirmed int      `xml:"everconfirmed" json:"everconfirmed"`   // 1
-	Cc            []string `xml:"cc" json:"cc"`                         // user@foobar.com
-	EstimatedTime string   `xml:"estimated_time" json:"estimated_time"` // 0.00
-	RemainingTime string   `xml:"remaining_time" json:"remaining_time"` // 0.00
-	ActualTime    string   `xml:"actual_time" json:"actual_time"`       // 0.00
+	EverConfirmed int      `xml:"everconfirmed" json:"everconfirmed"`          // 1
+	Cc            []string `xml:"cc" json:"cc"`                                // user@foobar.com
+	EstimatedTime float64  `xml:"estimated_time" json:"estimated_time,string"` // 0.00
+	RemainingTime float64  `xml:"remaining_time" json:"remaining_time,string"` // 0.00
+	ActualTime    float64  `xml:"actual_time" json:"actual_time,string"`       // 0.00
+	Deadline      string   `xml:"deadline" json:"deadline"`                    // 2019-04-01
 
 	CfFoundby       []string `xml:"cf_foundby" json:"cf_foundby"`             // ---
 	CfNtsPriority   []string `xml:"cf_nts_priority" json:"cf_nts_priority"`   //
@@ -228,6 +321,8 @@ type shadowBug struct {
 	Error string `xml:"error,attr"`
 
 	Bug
+	// the bug_id of errors is what was asked for, which can be an alias
+	RawBugID    string             `xml:"bug_id" json:"bug_id"`
 	CreationTS  bzTime             `xml:"creation_ts" json:"creation_ts"` // 2017-07-03 13:29:00 +0000
 	DeltaTS     bzTime             `xml:"delta_ts" json:"delta_ts"`       // 2019-03-27 10:45:20 +0000
 	Attachments []shadowAttachment `xml:"attachment" json:"attachment"`
@@ -293,41 +388,59 @@ func (m *bzTime) UnmarshalText(p []byte) error {
 	return nil
 }
 
-func (c *Client) decodeBug(data []byte) (*Bug, error) {
-	var result xmlResult
-	err := xml.Unmarshal(data, &result)
+type xmlMultiResult struct {
+	XMLName xml.Name    `xml:"bugzilla" json:"bugzilla"`
+	Shadows []shadowBug `xml:"bug" json:"bug"`
+}
+
+func unmarshalBugzillaXML(data []byte, result interface{}) error {
+	err := xml.Unmarshal(data, result)
 	if err != nil {
 		if strings.Contains(err.Error(), "expected element type <bugzilla> but have <html>") {
 			err = fmt.Errorf("Got redirected to an HTML page. The Bugzilla URL or credentials might be incorrect.")
 		}
-		return nil, ConnectionError{err}
-	}
-
-	if result.Shadow.Error != "" {
-		return nil, ConnectionError{fmt.Errorf("code: %s", result.Shadow.Error)}
+		return ConnectionError{err}
 	}
+	return nil
+}
 
+func (shadow *shadowBug) toBug() *Bug {
 	var bug Bug
 	// This is getting annoying:
-	bug = result.Shadow.Bug
-	bug.CreationTS = result.Shadow.CreationTS.Time
-	bug.DeltaTS = result.Shadow.DeltaTS.Time
+	bug = shadow.Bug
+	bug.BugID, _ = strconv.Atoi(shadow.RawBugID)
+	bug.CreationTS = shadow.CreationTS.Time
+	bug.DeltaTS = shadow.DeltaTS.Time
 
-	for _, shadowAttachment := range result.Shadow.Attachments {
+	for _, shadowAttachment := range shadow.Attachments {
 		att := Attachment{}
 		att = shadowAttachment.Attachment
 		att.Date = shadowAttachment.Date.Time
 		att.DeltaTS = shadowAttachment.DeltaTS.Time
 		bug.Attachments = append(bug.Attachments, &att)
 	}
-	for _, shadowComment := range result.Shadow.Comments {
+	for _, shadowComment := range shadow.Comments {
 		comm := Comment{}
 		comm = shadowComment.Comment
 		comm.BugWhen = shadowComment.BugWhen.Time
 		bug.Comments = append(bug.Comments, &comm)
 	}
 
-	return &bug, nil
+	return &bug
+}
+
+func (c *Client) decodeBug(data []byte) (*Bug, error) {
+	var result xmlResult
+	err := unmarshalBugzillaXML(data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Shadow.Error != "" {
+		return nil, ConnectionError{fmt.Errorf("code: %s", result.Shadow.Error)}
+	}
+
+	return result.Shadow.toBug(), nil
 }
 
 func (c *Client) patchBug(source []byte) []byte {
@@ -357,21 +470,9 @@ func (c *Client) GetBug(id int) (*Bug, error) {
 		return nil, err
 	}
 
-	resp, err := c.seriousClient.Get(url)
-	if err != nil {
-		return nil, ConnectionError{err}
-	}
-	defer resp.Body.Close()
-	defer io.Copy(ioutil.Discard, resp.Body)
-
-	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		return nil, ConnectionError{fmt.Errorf(http.StatusText(resp.StatusCode))}
-	}
-
-	limitedReader := &io.LimitedReader{R: resp.Body, N: 10 * 1024 * 1024}
-	body, err := ioutil.ReadAll(limitedReader)
+	body, err := c.getBody(url)
 	if err != nil {
-		return nil, ConnectionError{err}
+		return nil, err
 	}
 
 	patched := c.patchBug(body)
@@ -384,6 +485,99 @@ func (c *Client) GetBug(id int) (*Bug, error) {
 	return bug, err
 }
 
+// GetBugByAlias gets the bug with the alias, as in "CVE-2023-1234". An
+// unknown alias is a BugError with the code NotFound.
+func (c *Client) GetBugByAlias(alias string) (*Bug, error) {
+	if alias == "" {
+		return nil, RequestError{fmt.Errorf("empty alias")}
+	}
+	if _, err := strconv.Atoi(alias); err == nil {
+		return nil, RequestError{fmt.Errorf("invalid alias %s: aliases can't be numbers", alias)}
+	}
+	url, err := c.getURL("show_bug.cgi", map[string]string{"id": alias, "ctype": "xml", "excludefield": "attachmentdata"})
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.getBody(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var result xmlResult
+	if err = unmarshalBugzillaXML(c.patchBug(body), &result); err != nil {
+		return nil, err
+	}
+	switch result.Shadow.Error {
+	case "":
+	case "InvalidBugId", "NotFound":
+		// what isn't a number nor a known alias is an invalid bug id
+		return nil, BugError{Alias: alias, Code: "NotFound"}
+	default:
+		return nil, BugError{Alias: alias, Code: result.Shadow.Error}
+	}
+	bug := result.Shadow.toBug()
+	c.cacheBug(bug)
+	return bug, nil
+}
+
+// BugError is set by GetBugs() for the bugs that could not be fetched, and
+// returned by GetBugByAlias(), with Alias set
+type BugError struct {
+	ID    int
+	Alias string
+	Code  string // NotFound, NotPermitted, InvalidBugId
+}
+
+func (e BugError) Error() string {
+	if e.Alias != "" {
+		return fmt.Sprintf("cannot get bug %s: %s", e.Alias, e.Code)
+	}
+	return fmt.Sprintf("cannot get bug %d: %s", e.ID, e.Code)
+}
+
+// GetBugs fetches several bugs in a single request. The bugs are returned
+// in the order sent by the server, along with a BugError for each bug that
+// could not be fetched.
+func (c *Client) GetBugs(ids []int) ([]*Bug, []BugError, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	url, err := c.getURL("show_bug.cgi", map[string]string{"ctype": "xml", "excludefield": "attachmentdata"})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range ids {
+		url += fmt.Sprintf("&id=%d", id)
+	}
+
+	body, err := c.getBody(url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result xmlMultiResult
+	err = unmarshalBugzillaXML(c.patchBug(body), &result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bugs []*Bug
+	var bugErrors []BugError
+	for i := range result.Shadows {
+		shadow := &result.Shadows[i]
+		if shadow.Error != "" {
+			id, _ := strconv.Atoi(shadow.RawBugID)
+			bugErrors = append(bugErrors, BugError{ID: id, Code: shadow.Error})
+			continue
+		}
+		bug := shadow.toBug()
+		c.cacheBug(bug)
+		bugs = append(bugs, bug)
+	}
+	return bugs, bugErrors, nil
+}
+
 // ErrBugzilla is an error from Bugzilla
 type ErrBugzilla struct{ error }
 
@@ -391,8 +585,8 @@ func (e ErrBugzilla) Error() string {
 	return fmt.Sprintf("Error from Bugzilla: %v", e.error)
 }
 
-func (c *Client) inspectBugzillaResponse() (err error) {
-	dom := c.browser.Dom()
+func (c *Client) inspectBugzillaResponse(p *page) (err error) {
+	dom := p.doc.Selection
 	html, err := dom.Html()
 	if err != nil {
 		return ErrBugzilla{fmt.Errorf("could not fetch the HTML response from bugzilla: %v", err)}
@@ -422,28 +616,29 @@ func (c *Client) inspectBugzillaResponse() (err error) {
 		if strings.Contains(joined, "Match Failed;") {
 			return ErrBugzilla{fmt.Errorf("Bugzilla was unable to make any match at all for one or more of the names and/or email addresses")}
 		}
-		return ErrBugzilla{fmt.Errorf("Message: %s", joined)}
+		return ErrBugzilla{fmt.Errorf("Message: %s", c.redact(joined))}
 	}
 	return
 }
 
-func (c *Client) clearNeedinfo(form browser.Submittable, all bool) (err error) {
+func clearNeedinfo(p *page, form *htmlForm, all bool) (err error) {
 	count := 0
-	dom := c.browser.Dom()
-	dom.Find("input[id^=needinfo_override_]").Each(func(i int, s *goquery.Selection) {
+	p.doc.Find("input[id^=needinfo_override_]").Each(func(i int, s *goquery.Selection) {
 		if count > 0 && !all {
 			err = RequestError{fmt.Errorf("More than one needinfo found")}
 			return
 		}
-		v, _ := s.Attr("id")
-		form.Check(v)
+		if err = form.Check(s.AttrOr("name", "")); err != nil {
+			err = ErrBugzilla{err}
+			return
+		}
 		count++
 	})
 	return
 }
 
-func (c *Client) findClearNeedinfoFor(email string) (controlName string, err error) {
-	dom := c.browser.Dom()
+func findClearNeedinfoFor(p *page, email string) (controlName string, err error) {
+	dom := p.doc
 	found := false
 	expr := fmt.Sprintf(`input[name^="requestee-"][value="%s"]`, email)
 	dom.Find(expr).Each(func(i int, s *goquery.Selection) {
@@ -464,7 +659,8 @@ func (c *Client) findClearNeedinfoFor(email string) (controlName string, err err
 }
 
 // PriorityMap maps short priority names to the longer ones, as provided by
-// the Web Interface
+// the Web Interface. It is used when the server configuration has not been
+// loaded with GetConfiguration().
 var PriorityMap = map[string]string{
 	"P0": "P0 - Crit Sit",
 	"P1": "P1 - Urgent",
@@ -492,32 +688,123 @@ type Changes struct {
 	SetStatus      string
 	SetResolution  string
 	SetDuplicate   int
+	SetSeverity    string
+	SetQAContact   string
+	SetPlatform    string
+	SetOpSys       string
+	SetVersion     string
+
+	// Time tracking: SetEstimatedTime and SetRemainingTime are pointers so
+	// that they can be set to zero. AddWorkTime requires AddComment.
+	SetEstimatedTime *float64
+	SetRemainingTime *float64
+	AddWorkTime      float64
+	SetDeadline      time.Time
+	ClearDeadline    bool
 
 	AddCc    string
 	RemoveCc string
 	CcMyself bool
 
+	// A bug can only have several aliases since Bugzilla 5, adding one
+	// to a bug that has another fails with older versions
+	AddAlias    string
+	RemoveAlias string
+
+	// Token edits of the status whiteboard, applied to its value in the
+	// bug form, after SetWhiteboard, so that other tokens changed in the
+	// meantime are kept. Each can have several tokens separated by
+	// spaces. SetWhiteboardToken replaces the tokens of the same key, as
+	// in "wasL3:48626".
+	AddWhiteboardToken    string
+	RemoveWhiteboardToken string
+	RemoveWhiteboardKey   string
+	SetWhiteboardToken    string
+
 	// DeltaTS should have the timestamp of the last change
 	DeltaTS      time.Time
 	CheckDeltaTS bool
+
+	// RefreshBug fetches the bug again after the update, filling
+	// UpdateResult.Bug
+	RefreshBug bool
 }
 
-func getDeltaTS(form browser.Submittable) (t *time.Time, err error) {
-	raw, err := form.Value("delta_ts")
-	if err != nil {
-		return nil, ErrBugzilla{fmt.Errorf("can't detect mid-air collision without delta_ts in the bug form: %v", err)}
+// UpdateResult is what Bugzilla reports after Update(). DeltaTS is the
+// new timestamp of the bug, to be used with Changes.CheckDeltaTS in the
+// next update; it is zero when Bugzilla didn't show the bug form after
+// the change and RefreshBug was not set. Recipients are the users that
+// were emailed about the change, OtherBugs the bugs also changed, as
+// the duplicated bug or dependencies.
+type UpdateResult struct {
+	DeltaTS    time.Time
+	Recipients []string
+	OtherBugs  []int
+	Bug        *Bug
+}
+
+var submittedBugRe = regexp.MustCompile(`bug (\d+)`)
+
+// parseUpdateResult reads the "Changes submitted for bug N" entries of the
+// page shown by process_bug.cgi, also telling whether id was among them
+func parseUpdateResult(p *page, id int) (result *UpdateResult, found bool) {
+	result = &UpdateResult{Recipients: []string{}, OtherBugs: []int{}}
+	p.doc.Find("dt").Each(func(i int, dt *goquery.Selection) {
+		text := strings.Join(strings.Fields(dt.Text()), " ")
+		if !strings.HasPrefix(text, "Changes submitted for") {
+			return
+		}
+		match := submittedBugRe.FindStringSubmatch(text)
+		if match == nil {
+			return
+		}
+		submitted, _ := strconv.Atoi(match[1])
+		if submitted != id {
+			result.OtherBugs = append(result.OtherBugs, submitted)
+			return
+		}
+		found = true
+		dt.Next().Find("dt").Each(func(i int, label *goquery.Selection) {
+			if !strings.Contains(label.Text(), "Email sent to") {
+				return
+			}
+			label.Next().Find("code").Each(func(i int, code *goquery.Selection) {
+				result.Recipients = append(result.Recipients, strings.TrimSpace(code.Text()))
+			})
+		})
+	})
+	raw, ok := p.doc.Find("form[name=changeform] input[name=delta_ts]").Attr("value")
+	if ok {
+		if delta, err := parseFormDeltaTS(raw); err == nil {
+			result.DeltaTS = *delta
+		}
 	}
+	return
+}
+
+func parseFormDeltaTS(raw string) (*time.Time, error) {
 	raw += " +0000" // this is a workaround against a bad delta_ts sent by the web interface
 	var delta bzTime
-	err = delta.UnmarshalText([]byte(raw))
+	err := delta.UnmarshalText([]byte(raw))
+	if err != nil {
+		return nil, err
+	}
+	return &delta.Time, nil
+}
+
+func getDeltaTS(form *htmlForm) (t *time.Time, err error) {
+	raw, ok := form.Value("delta_ts")
+	if !ok {
+		return nil, ErrBugzilla{fmt.Errorf("can't detect mid-air collision without delta_ts in the bug form")}
+	}
+	t, err = parseFormDeltaTS(raw)
 	if err != nil {
 		return nil, ErrBugzilla{fmt.Errorf("failed to parse delta_ts to prevent mid-air collision")}
 	}
-	t = &delta.Time
 	return
 }
 
-func (c *Client) checkDeltaTS(changes *Changes, form browser.Submittable) error {
+func (c *Client) checkDeltaTS(changes *Changes, form *htmlForm) error {
 	if changes.CheckDeltaTS {
 		delta, err := getDeltaTS(form)
 		if err != nil {
@@ -531,23 +818,158 @@ func (c *Client) checkDeltaTS(changes *Changes, form browser.Submittable) error
 	return nil
 }
 
+// setSelect sets the value of a select element after checking that it is
+// one of the options offered by the form
+func setSelect(form *htmlForm, name, value string) error {
+	options := form.Options(name)
+	if len(options) == 0 {
+		return ErrBugzilla{fmt.Errorf("no options for %s found in the bug form", name)}
+	}
+	if !contains(options, value) {
+		return InvalidValueError{name, value}
+	}
+	form.Set(name, value)
+	return nil
+}
+
+// bugzillaVersion finds the version of Bugzilla in the configuration, if
+// loaded, or in the XML of the bug id
+func (c *Client) bugzillaVersion(id int) (string, error) {
+	if configuration := c.loadedConfiguration(); configuration != nil && configuration.Version != "" {
+		return configuration.Version, nil
+	}
+	c.mu.RLock()
+	version := c.version
+	c.mu.RUnlock()
+	if version != "" {
+		return version, nil
+	}
+
+	url, err := c.getShowBugURL(id, map[string]string{"ctype": "xml", "field": "bug_id"})
+	if err != nil {
+		return "", err
+	}
+	body, err := c.getBody(url)
+	if err != nil {
+		return "", err
+	}
+	var root struct {
+		XMLName xml.Name `xml:"bugzilla"`
+		Version string   `xml:"version,attr"`
+	}
+	if err = unmarshalBugzillaXML(body, &root); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.version = root.Version
+	c.mu.Unlock()
+	return root.Version, nil
+}
+
+// multipleAliases tells whether the version of Bugzilla allows several
+// aliases per bug, as 5.0 and later do. Unknown versions are assumed to.
+func multipleAliases(version string) bool {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return err != nil || major >= 5
+}
+
+// setAliases changes the alias field, which has the aliases separated by
+// commas. Bugzilla before 5.0 only has room for one.
+func (c *Client) setAliases(id int, changes *Changes, form *htmlForm) error {
+	if changes.AddAlias == "" && changes.RemoveAlias == "" {
+		return nil
+	}
+	current, ok := form.Value("alias")
+	if !ok {
+		return ErrBugzilla{fmt.Errorf("no alias field found in the bug form")}
+	}
+	var aliases []string
+	for _, alias := range strings.Split(current, ",") {
+		alias = strings.TrimSpace(alias)
+		if alias != "" && alias != changes.RemoveAlias && alias != changes.AddAlias {
+			aliases = append(aliases, alias)
+		}
+	}
+	if changes.AddAlias != "" {
+		aliases = append(aliases, changes.AddAlias)
+	}
+	if len(aliases) > 1 {
+		version, err := c.bugzillaVersion(id)
+		if err != nil {
+			return err
+		}
+		if !multipleAliases(version) {
+			return RequestError{fmt.Errorf("cannot set the aliases %s: Bugzilla %s allows only one alias per bug, several need Bugzilla 5",
+				strings.Join(aliases, ", "), version)}
+		}
+	}
+	form.Set("alias", strings.Join(aliases, ", "))
+	return nil
+}
+
+func formatHours(hours float64) string {
+	return strconv.FormatFloat(hours, 'f', 2, 64)
+}
+
+func setTimeTracking(changes *Changes, form *htmlForm) error {
+	if changes.SetEstimatedTime != nil {
+		if *changes.SetEstimatedTime < 0 {
+			return RequestError{fmt.Errorf("invalid estimated time: %v", *changes.SetEstimatedTime)}
+		}
+		form.Set("estimated_time", formatHours(*changes.SetEstimatedTime))
+	}
+	if changes.SetRemainingTime != nil {
+		if *changes.SetRemainingTime < 0 {
+			return RequestError{fmt.Errorf("invalid remaining time: %v", *changes.SetRemainingTime)}
+		}
+		form.Set("remaining_time", formatHours(*changes.SetRemainingTime))
+	}
+	if changes.AddWorkTime != 0 {
+		if changes.AddComment == "" {
+			return RequestError{fmt.Errorf("a comment is required when adding work time")}
+		}
+		form.Set("work_time", formatHours(changes.AddWorkTime))
+	}
+	if !changes.SetDeadline.IsZero() {
+		form.Set("deadline", changes.SetDeadline.Format("2006-01-02"))
+	} else if changes.ClearDeadline {
+		form.Set("deadline", "")
+	}
+	return nil
+}
+
 // Update changes a bug with the attribute to be modified provided by
-// Changes
-func (c *Client) Update(id int, changes Changes) (err error) {
+// Changes. The UpdateResult has what Bugzilla reported about the change.
+func (c *Client) Update(id int, changes Changes) (result *UpdateResult, err error) {
+	configuration := c.loadedConfiguration()
+	if configuration != nil {
+		if err = configuration.validate(&changes, ""); err != nil {
+			return
+		}
+	}
 	url, err := c.getShowBugURL(id, nil)
 	if err != nil {
 		return
 	}
-	err = c.browser.Open(url)
+	p, err := c.openPage(url)
+	if err == ErrAPIKeyNotAccepted {
+		return nil, err
+	}
 	if err != nil {
-		return ErrBugzilla{fmt.Errorf("failed to get the update form: %v", err)}
+		return nil, ErrBugzilla{fmt.Errorf("failed to get the update form: %v", c.redactError(err))}
 	}
-	form, err := c.browser.Form("form[name=changeform]")
+	form, err := p.form("form[name=changeform]")
 	if err != nil {
-		return ErrBugzilla{fmt.Errorf("failed to find the form element in the bug html: %v", err)}
+		return nil, ErrBugzilla{fmt.Errorf("failed to find the form element in the bug html: %v", err)}
 	}
 	if err = c.checkDeltaTS(&changes, form); err != nil {
-		return err
+		return nil, err
+	}
+	if product, ok := form.Value("product"); ok && configuration != nil {
+		// now that the product is known, for its versions
+		if err = configuration.validate(&changes, product); err != nil {
+			return nil, err
+		}
 	}
 	if changes.SetNeedinfo != "" {
 		form.Set("needinfo", "1")
@@ -556,14 +978,14 @@ func (c *Client) Update(id int, changes Changes) (err error) {
 	}
 	if changes.RemoveNeedinfo != "" {
 		control := ""
-		control, err = c.findClearNeedinfoFor(changes.RemoveNeedinfo)
+		control, err = findClearNeedinfoFor(p, changes.RemoveNeedinfo)
 		if err != nil {
 			return
 		}
 		form.Set(control, "1")
 	}
 	if changes.ClearNeedinfo {
-		err = c.clearNeedinfo(form, changes.ClearAllNeedinfos)
+		err = clearNeedinfo(p, form, changes.ClearAllNeedinfos)
 		if err != nil {
 			return
 		}
@@ -585,9 +1007,9 @@ func (c *Client) Update(id int, changes Changes) (err error) {
 		form.Set("short_desc", changes.SetDescription)
 	}
 	if changes.SetPriority != "" {
-		prio, ok := PriorityMap[changes.SetPriority]
+		prio, ok := c.priorityMap()[changes.SetPriority]
 		if !ok {
-			return ErrBugzilla{fmt.Errorf("invalid priority value: %v", changes.SetPriority)}
+			return nil, InvalidValueError{"priority", changes.SetPriority}
 		}
 		form.Set("priority", prio)
 	}
@@ -604,27 +1026,71 @@ func (c *Client) Update(id int, changes Changes) (err error) {
 	if changes.SetWhiteboard != "" {
 		form.Set("status_whiteboard", changes.SetWhiteboard)
 	}
+	if err = setWhiteboardTokens(&changes, form); err != nil {
+		return
+	}
+	if err = c.setAliases(id, &changes, form); err != nil {
+		return
+	}
+	if workflow := c.loadedWorkflow(); workflow != nil {
+		current, _ := form.Value("bug_status")
+		if err = workflow.checkTransition(current, &changes); err != nil {
+			return
+		}
+	}
 	if changes.SetStatus != "" {
-		form.Set("bug_status", changes.SetStatus)
+		if err = setSelect(form, "bug_status", changes.SetStatus); err != nil {
+			return
+		}
 	}
 	if changes.SetResolution != "" {
-		form.Set("resolution", changes.SetResolution)
+		if err = setSelect(form, "resolution", changes.SetResolution); err != nil {
+			return
+		}
 	}
 	if changes.SetDuplicate != 0 {
 		form.Set("dup_id", fmt.Sprintf("%d", changes.SetDuplicate))
 	}
+	if changes.SetQAContact != "" {
+		form.Set("qa_contact", changes.SetQAContact)
+	}
+	selects := []struct{ name, value string }{
+		{"bug_severity", changes.SetSeverity},
+		{"rep_platform", changes.SetPlatform},
+		{"op_sys", changes.SetOpSys},
+		{"version", changes.SetVersion},
+	}
+	for _, sel := range selects {
+		if sel.value == "" {
+			continue
+		}
+		if err = setSelect(form, sel.name, sel.value); err != nil {
+			return
+		}
+	}
+	if err = setTimeTracking(&changes, form); err != nil {
+		return
+	}
 
-	// surf fails to parse cclist_accessible and reporter_accessible
-	// https://github.com/headzoo/surf/issues/109
-	form.Remove("defined_cclist_accessible")
-	form.Remove("defined_reporter_accessible")
-	form.Remove("defined_group")
-
-	err = form.Submit()
+	answer, err := c.submit(form)
+	if err == ErrAPIKeyNotAccepted {
+		return nil, err
+	}
 	if err != nil {
-		return ErrBugzilla{fmt.Errorf("failed to send a request to bugzilla: %v", err)}
+		return nil, ErrBugzilla{fmt.Errorf("failed to send a request to bugzilla: %v", c.redactError(err))}
+	}
+	if err = c.inspectBugzillaResponse(answer); err != nil {
+		return
+	}
+	result, _ = parseUpdateResult(answer, id)
+	if changes.RefreshBug {
+		if result.Bug, err = c.GetBug(id); err != nil {
+			return
+		}
+		if result.DeltaTS.IsZero() {
+			result.DeltaTS = result.Bug.DeltaTS
+		}
 	}
-	err = c.inspectBugzillaResponse()
 	return
 }
 
@@ -655,7 +1121,7 @@ func (c *Client) DownloadAttachment(id int) (*Attachment, io.ReadCloser, error)
 
 	resp, err := c.seriousClient.Get(url)
 	if err != nil {
-		return nil, nil, ConnectionError{err}
+		return nil, nil, ConnectionError{c.redactError(err)}
 	}
 
 	att, err := getAttachmentFromResponse(id, resp)
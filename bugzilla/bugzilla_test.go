@@ -13,7 +13,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/bhdn/go-suseapi/bugzilla"
+	"github.com/beninidavide/go-suseapi/bugzilla"
 	. "gopkg.in/check.v1"
 )
 
@@ -26,9 +26,6 @@ var _ = Suite(&clientSuite{})
 // Hook up check.v1 into the "go test" runner
 func Test(t *testing.T) { TestingT(t) }
 
-func (cs *clientSuite) SetUpTest(c *C) {
-}
-
 func makeClient(url string) *bugzilla.Client {
 	config := bugzilla.Config{BaseURL: url,
 		User: "me", Password: "letmein"}
@@ -241,9 +238,9 @@ func (cs *clientSuite) TestGetBug(c *C) {
 	sort.Strings(bug.Cc)
 	c.Assert(bug.Cc[0], Equals, "anotheremail@gmail.com")
 	c.Assert(bug.Cc[1], Equals, "username@foobar.com")
-	c.Assert(bug.EstimatedTime, Equals, "0.00")
-	c.Assert(bug.ActualTime, Equals, "0.00")
-	c.Assert(bug.RemainingTime, Equals, "0.00")
+	c.Assert(bug.EstimatedTime, Equals, 0.0)
+	c.Assert(bug.ActualTime, Equals, 0.0)
+	c.Assert(bug.RemainingTime, Equals, 0.0)
 	c.Assert(bug.QAContact.Name, Equals, "Firstname Lastname")
 	c.Assert(bug.Votes, Equals, 0)
 	c.Assert(len(bug.Groups), Equals, 2)
@@ -2322,7 +2319,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes := bugzilla.Changes{SetNeedinfo: email}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err := bz.Update(101234, changes)
+	_, err := bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query := <-queries
 	c.Assert(query.Get("needinfo"), Equals, "1")
@@ -2333,7 +2330,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddComment: comment}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("comment"), Equals, comment)
@@ -2344,7 +2341,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddComment: comment, CommentIsPrivate: true}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("comment"), Equals, comment)
@@ -2354,7 +2351,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{ClearNeedinfo: true}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("needinfo_override_201661"), Equals, "1")
@@ -2362,14 +2359,14 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{ClearNeedinfo: true, ClearAllNeedinfos: false}
 	showBug <- strings.Replace(strings.Replace(showBugHtml, "<!--EXTRANEEDINFO", "", -1), "EXTRANEEDINFO-->", "", -1)
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, NotNil)
 	c.Assert(err, ErrorMatches, ".*More than one needinfo found.*")
 
 	changes = bugzilla.Changes{ClearNeedinfo: true, ClearAllNeedinfos: true}
 	showBug <- strings.Replace(strings.Replace(showBugHtml, "<!--EXTRANEEDINFO", "", -1), "EXTRANEEDINFO-->", "", -1)
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("needinfo_override_201661"), Equals, "1")
@@ -2381,7 +2378,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{RemoveNeedinfo: email}
 	showBug <- strings.Replace(strings.Replace(showBugHtml, "<!--EXTRANEEDINFO", "", -1), "EXTRANEEDINFO-->", "", -1)
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("needinfo_override_201661"), Equals, "")
@@ -2394,7 +2391,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 		`value="user2&#64;foobar.com" class="requestee"  id="requestee-201662"`, -1)
 	showBug <- html
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("needinfo_override_201661"), Equals, "1")
@@ -2404,7 +2401,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetURL: url}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("bug_file_loc"), Equals, url)
@@ -2413,7 +2410,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetAssignee: assignee}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("assigned_to"), Equals, assignee)
@@ -2422,7 +2419,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetPriority: priority}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("priority"), Equals, "P0 - Crit Sit")
@@ -2431,7 +2428,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetPriority: priority}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, NotNil)
 	c.Assert(err, ErrorMatches, ".*invalid priority value.*")
 
@@ -2439,7 +2436,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddCc: cc}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("newcc"), Equals, cc)
@@ -2448,7 +2445,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddCc: cc}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("newcc"), Equals, cc)
@@ -2456,7 +2453,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{CcMyself: true}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("addselfcc"), Equals, "1")
@@ -2465,7 +2462,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{RemoveCc: remove}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	removed, ok := query["cc"]
@@ -2477,7 +2474,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetDescription: title}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("short_desc"), Equals, title)
@@ -2486,7 +2483,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetWhiteboard: whiteboard}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("status_whiteboard"), Equals, whiteboard)
@@ -2495,7 +2492,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetStatus: status}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("bug_status"), Equals, status)
@@ -2504,7 +2501,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetResolution: resolution}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("resolution"), Equals, resolution)
@@ -2513,7 +2510,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{SetDuplicate: duplicate}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, IsNil)
 	query = <-queries
 	c.Assert(query.Get("dup_id"), Equals, fmt.Sprintf("%d", duplicate))
@@ -2522,7 +2519,7 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddComment: "Some comment", DeltaTS: delta, CheckDeltaTS: true}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
 	c.Assert(err, NotNil)
 	c.Assert(err, ErrorMatches, ".*collision.*")
 
@@ -2530,8 +2527,111 @@ func (cs *clientSuite) TestUpdateNeedinfo(c *C) {
 	changes = bugzilla.Changes{AddComment: "Some comment", DeltaTS: delta, CheckDeltaTS: true}
 	showBug <- showBugHtml
 	processBug <- changesSubmitted
-	err = bz.Update(101234, changes)
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, IsNil)
+}
+
+func (cs *clientSuite) TestUpdateSelectFields(c *C) {
+	queries := make(chan url.Values, 10)
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			r.ParseForm()
+			queries <- r.Form
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+	}))
+	defer ts0.Close()
+	bz := makeClient(ts0.URL)
+
+	changes := bugzilla.Changes{SetSeverity: "Major", SetPlatform: "aarch64",
+		SetOpSys: "Frobware 5.1", SetVersion: "GM", SetQAContact: "qa@foobar.com"}
+	_, err := bz.Update(101234, changes)
 	c.Assert(err, IsNil)
+	query := <-queries
+	c.Assert(query.Get("bug_severity"), Equals, "Major")
+	c.Assert(query.Get("rep_platform"), Equals, "aarch64")
+	c.Assert(query.Get("op_sys"), Equals, "Frobware 5.1")
+	c.Assert(query.Get("version"), Equals, "GM")
+	c.Assert(query.Get("qa_contact"), Equals, "qa@foobar.com")
+
+	changes = bugzilla.Changes{SetSeverity: "Blocker"}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, ErrorMatches, ".*invalid bug_severity value: Blocker.*")
+	// the same error as when checking against the configuration
+	c.Assert(err, Equals, bugzilla.InvalidValueError{Field: "bug_severity", Value: "Blocker"})
+
+	changes = bugzilla.Changes{SetOpSys: "FrobWare 5.1"}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, ErrorMatches, ".*invalid op_sys value.*")
+
+	changes = bugzilla.Changes{SetVersion: "Milestone 9"}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, ErrorMatches, ".*invalid version value.*")
+}
+
+func (cs *clientSuite) TestUpdateTimeTracking(c *C) {
+	queries := make(chan url.Values, 10)
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			r.ParseForm()
+			queries <- r.Form
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+	}))
+	defer ts0.Close()
+	bz := makeClient(ts0.URL)
+
+	estimated := 12.5
+	remaining := 0.0
+	changes := bugzilla.Changes{SetEstimatedTime: &estimated, SetRemainingTime: &remaining}
+	_, err := bz.Update(101234, changes)
+	c.Assert(err, IsNil)
+	query := <-queries
+	c.Assert(query.Get("estimated_time"), Equals, "12.50")
+	c.Assert(query.Get("remaining_time"), Equals, "0.00")
+	c.Assert(query.Get("work_time"), Equals, "0")
+
+	changes = bugzilla.Changes{AddWorkTime: 1.25, AddComment: "worked on it"}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, IsNil)
+	query = <-queries
+	c.Assert(query.Get("work_time"), Equals, "1.25")
+	c.Assert(query.Get("comment"), Equals, "worked on it")
+
+	changes = bugzilla.Changes{AddWorkTime: 1}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, ErrorMatches, ".*comment is required.*")
+
+	negative := -1.0
+	changes = bugzilla.Changes{SetRemainingTime: &negative}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, ErrorMatches, ".*invalid remaining time.*")
+
+	changes = bugzilla.Changes{SetDeadline: time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, IsNil)
+	query = <-queries
+	c.Assert(query.Get("deadline"), Equals, "2019-04-01")
+
+	changes = bugzilla.Changes{ClearDeadline: true}
+	_, err = bz.Update(101234, changes)
+	c.Assert(err, IsNil)
+	query = <-queries
+	values, ok := query["deadline"]
+	c.Assert(ok, Equals, true)
+	c.Assert(values, DeepEquals, []string{""})
 }
 
 func (cs *clientSuite) TestUnauthorized(c *C) {
@@ -2762,6 +2862,7 @@ func (cs *clientSuite) TestGetFromJSON(c *C) {
 	c.Check(bug.Comments[0].BugWhen, Equals, time.Date(2019, 03, 20, 19, 48, 42, 0, time.UTC))
 	c.Check(bug.CreationTS, Equals, time.Date(2019, 03, 20, 19, 48, 0, 0, time.UTC))
 	c.Check(bug.Cc, DeepEquals, []string{"lfirstname@foobar.com", "user@foobar.com"})
+	c.Check(bug.RemainingTime, Equals, 0.0)
 }
 
 func (cs *clientSuite) TestUpdateConnectionClosed(c *C) {
@@ -2772,6 +2873,95 @@ func (cs *clientSuite) TestUpdateConnectionClosed(c *C) {
 	defer ts0.Close()
 	bz := makeClient(ts0.URL)
 	changes := bugzilla.Changes{AddComment: "Some comment"}
-	err := bz.Update(101234, changes)
+	_, err := bz.Update(101234, changes)
 	c.Assert(err, ErrorMatches, ".*failed to get the update form.*")
 }
+
+var changesSubmittedWithForm = `
+<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN" "http://www.w3.org/TR/html4/loose.dtd"><html lang="en"><head>
+    <title>Bug 1047068 processed</title>
+  </head>
+  <body>
+<dl>
+  <dt>Changes submitted for <a class="bz_bug_link
+          bz_status_RESOLVED  bz_closed" title="RESOLVED DUPLICATE - test cloud bug" href="show_bug.cgi?id=1047068">bug 1047068</a></dt>
+  <dd><dl><dt>Email sent to:</dt>
+  <dd>
+        <code>user@foobar.com</code>,
+        <code>lfirstname@foobar.com</code>
+  </dd>
+<dt>Excluding:</dt>
+  <dd>
+        <code>me@foobar.com</code>
+  </dd>
+</dl></dd>
+</dl>
+<dl>
+  <dt>Changes submitted for <a class="bz_bug_link
+          bz_status_NEW" title="NEW - the original bug" href="show_bug.cgi?id=1040000">bug 1040000</a></dt>
+  <dd><dl><dt>Email sent to:</dt>
+  <dd>
+        <code>someone@foobar.com</code>
+  </dd>
+</dl></dd>
+</dl>
+<form name="changeform" id="changeform" method="post" action="process_bug.cgi">
+  <input type="hidden" name="delta_ts" value="2019-03-28 12:01:02">
+  <input type="hidden" name="id" value="1047068">
+</form>
+</body></html>
+`
+
+func (cs *clientSuite) TestUpdateResult(c *C) {
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			io.WriteString(w, changesSubmittedWithForm)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+	bz := makeClient(ts0.URL)
+
+	result, err := bz.Update(1047068, bugzilla.Changes{SetDuplicate: 1040000})
+	c.Assert(err, IsNil)
+	c.Check(result.DeltaTS, Equals, time.Date(2019, 03, 28, 12, 1, 2, 0, time.UTC))
+	c.Check(result.Recipients, DeepEquals, []string{"user@foobar.com", "lfirstname@foobar.com"})
+	c.Check(result.OtherBugs, DeepEquals, []int{1040000})
+	c.Check(result.Bug, IsNil)
+}
+
+func (cs *clientSuite) TestUpdateRefreshBug(c *C) {
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			if r.URL.Query().Get("ctype") == "xml" {
+				io.WriteString(w, bugXml)
+				return
+			}
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+	bz := makeClient(ts0.URL)
+
+	result, err := bz.Update(1047068, bugzilla.Changes{AddComment: "comment", RefreshBug: true})
+	c.Assert(err, IsNil)
+	c.Assert(result.Bug, NotNil)
+	c.Check(result.Bug.BugID, Equals, 1047068)
+	c.Check(result.DeltaTS, Equals, time.Date(2019, 03, 27, 10, 45, 20, 0, time.UTC))
+	c.Check(result.Recipients, HasLen, 0)
+	c.Check(result.OtherBugs, HasLen, 0)
+
+	// the served form still has an older delta_ts
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment",
+		DeltaTS: result.DeltaTS, CheckDeltaTS: true})
+	c.Assert(err, ErrorMatches, ".*likely mid-air collision.*")
+}
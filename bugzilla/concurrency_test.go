@@ -0,0 +1,143 @@
+package bugzilla_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const concurrentUpdates = 20
+
+func (cs *clientSuite) TestConcurrentUpdates(c *C) {
+	var mu sync.Mutex
+	submitted := make(map[string]string)
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config.cgi":
+			io.WriteString(w, configRDF)
+		case "/show_bug.cgi":
+			id := r.URL.Query().Get("id")
+			io.WriteString(w, strings.Replace(showBugHtml, `name="id" value="1047068"`,
+				fmt.Sprintf(`name="id" value="%s"`, id), -1))
+		case "/process_bug.cgi":
+			r.ParseForm()
+			mu.Lock()
+			submitted[r.PostForm.Get("id")] = r.PostForm.Get("comment")
+			mu.Unlock()
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*concurrentUpdates)
+	for i := 0; i < concurrentUpdates; i++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			_, err := bz.Update(id, bugzilla.Changes{AddComment: fmt.Sprintf("comment for %d", id)})
+			errs <- err
+		}(1000 + i)
+		go func() {
+			defer wg.Done()
+			_, err := bz.GetConfiguration()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Check(err, IsNil)
+	}
+
+	c.Assert(submitted, HasLen, concurrentUpdates)
+	for id, comment := range submitted {
+		n, err := strconv.Atoi(id)
+		c.Assert(err, IsNil)
+		c.Check(comment, Equals, fmt.Sprintf("comment for %d", n))
+	}
+}
+
+func (cs *clientSuite) TestConcurrentFormLogin(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	var mu sync.Mutex
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ls.handle(w, r)
+	}))
+	defer ts0.Close()
+
+	bz := makeFormLoginClient(c, ts0.URL, "letmein")
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentUpdates)
+	for i := 0; i < concurrentUpdates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Check(err, IsNil)
+	}
+	c.Check(ls.logins, Equals, 1)
+	c.Check(ls.submitted, Equals, concurrentUpdates)
+}
+
+func (cs *clientSuite) TestConcurrentExpiredSession(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	var mu sync.Mutex
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ls.handle(w, r)
+	}))
+	defer ts0.Close()
+
+	bz := makeFormLoginClient(c, ts0.URL, "letmein")
+	_, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+
+	mu.Lock()
+	ls.sessions = make(map[string]bool)
+	mu.Unlock()
+
+	// all the requests find the session expired, but only one of them
+	// logs in again
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentUpdates)
+	for i := 0; i < concurrentUpdates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = bz.GetBug(1047068)
+			} else {
+				_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Check(err, IsNil)
+	}
+	c.Check(ls.logins, Equals, 2)
+	c.Check(ls.submitted, Equals, concurrentUpdates/2)
+}
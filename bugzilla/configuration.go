@@ -0,0 +1,397 @@
+package bugzilla
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Product as described by config.cgi, with the names of its components,
+// versions and target milestones
+type Product struct {
+	Name           string   `json:"name"`
+	Classification string   `json:"classification"`
+	Description    string   `json:"description"`
+	Components     []string `json:"components"`
+	Versions       []string `json:"versions"`
+	Milestones     []string `json:"milestones"`
+}
+
+// FlagType describes a flag (such as needinfo) that can be set on bugs or
+// attachments
+type FlagType struct {
+	ID                      int    `json:"id"`
+	Name                    string `json:"name"`
+	Description             string `json:"description"`
+	Type                    string `json:"type"` // bug or attachment
+	Requestable             bool   `json:"requestable"`
+	SpecificallyRequestable bool   `json:"specifically_requestable"`
+	Multiplicable           bool   `json:"multiplicable"`
+}
+
+// Field is a bug field known by the server. LegalValues is only set for
+// custom fields that have a fixed set of values.
+type Field struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        int      `json:"type"`
+	Custom      bool     `json:"custom"`
+	LegalValues []string `json:"legal_values"`
+}
+
+// Configuration has the legal values of the fields of the Bugzilla instance,
+// as provided by config.cgi
+type Configuration struct {
+	Version        string     `json:"version"`
+	Products       []Product  `json:"products"`
+	Statuses       []string   `json:"statuses"`
+	OpenStatuses   []string   `json:"open_statuses"`
+	ClosedStatuses []string   `json:"closed_statuses"`
+	Resolutions    []string   `json:"resolutions"`
+	Priorities     []string   `json:"priorities"`
+	Severities     []string   `json:"severities"`
+	Platforms      []string   `json:"platforms"`
+	OpSys          []string   `json:"op_sys"`
+	Keywords       []string   `json:"keywords"`
+	FlagTypes      []FlagType `json:"flag_types"`
+	Fields         []Field    `json:"fields"`
+}
+
+// The RDF document emitted by config.cgi. Namespaces are left out of the
+// tags as the local names are unique.
+type rdfValues struct {
+	Values []string `xml:"Seq>li"`
+}
+
+type rdfResources struct {
+	Resources []struct {
+		Resource string `xml:"resource,attr"`
+	} `xml:"Seq>li"`
+}
+
+// names extracts the names of the referenced objects, as the resources
+// look like component.cgi?name=Foo&product=Bar
+func (r rdfResources) names() (names []string) {
+	for _, li := range r.Resources {
+		u, err := url.Parse(li.Resource)
+		if err != nil {
+			continue
+		}
+		if name := u.Query().Get("name"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+type rdfNamed struct {
+	Name string `xml:"name"`
+}
+
+type rdfProduct struct {
+	Name           string       `xml:"name"`
+	Classification string       `xml:"classification"`
+	Description    string       `xml:"description"`
+	Components     rdfResources `xml:"components"`
+	Versions       rdfResources `xml:"versions"`
+	Milestones     rdfResources `xml:"target_milestones"`
+}
+
+type rdfField struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description"`
+	Type        int       `xml:"type"`
+	Custom      int       `xml:"custom"`
+	LegalValues rdfValues `xml:"legal_values"`
+}
+
+type rdfFlagType struct {
+	ID                      int    `xml:"id"`
+	Name                    string `xml:"name"`
+	Description             string `xml:"description"`
+	Type                    string `xml:"type"`
+	Requestable             int    `xml:"requestable"`
+	SpecificallyRequestable int    `xml:"specifically_requestable"`
+	Multiplicable           int    `xml:"multiplicable"`
+}
+
+type rdfExtra struct {
+	XMLName xml.Name
+	rdfValues
+}
+
+type rdfInstallation struct {
+	Version        string        `xml:"install_version"`
+	Statuses       rdfValues     `xml:"status"`
+	OpenStatuses   rdfValues     `xml:"status_open"`
+	ClosedStatuses rdfValues     `xml:"status_closed"`
+	Resolutions    rdfValues     `xml:"resolution"`
+	Priorities     rdfValues     `xml:"priority"`
+	Severities     rdfValues     `xml:"severity"`
+	Platforms      rdfValues     `xml:"platform"`
+	OpSys          rdfValues     `xml:"op_sys"`
+	Keywords       rdfValues     `xml:"keyword"`
+	KeywordObjects []rdfNamed    `xml:"keywords>Seq>li>keyword"`
+	Products       []rdfProduct  `xml:"products>Seq>li>product"`
+	Fields         []rdfField    `xml:"fields>Seq>li>field"`
+	FlagTypes      []rdfFlagType `xml:"flag_types>Seq>li>flag_type"`
+	Extra          []rdfExtra    `xml:",any"`
+}
+
+type rdfResult struct {
+	XMLName      xml.Name        `xml:"RDF"`
+	Installation rdfInstallation `xml:"installation"`
+}
+
+func decodeConfigurationRDF(data []byte) (*Configuration, error) {
+	var result rdfResult
+	err := xml.Unmarshal(data, &result)
+	if err != nil {
+		if strings.Contains(err.Error(), "but have <html>") {
+			err = fmt.Errorf("Got redirected to an HTML page. The Bugzilla URL or credentials might be incorrect.")
+		}
+		return nil, ConnectionError{err}
+	}
+
+	inst := result.Installation
+	config := &Configuration{
+		Version:        inst.Version,
+		Statuses:       inst.Statuses.Values,
+		OpenStatuses:   inst.OpenStatuses.Values,
+		ClosedStatuses: inst.ClosedStatuses.Values,
+		Resolutions:    inst.Resolutions.Values,
+		Priorities:     inst.Priorities.Values,
+		Severities:     inst.Severities.Values,
+		Platforms:      inst.Platforms.Values,
+		OpSys:          inst.OpSys.Values,
+		Keywords:       inst.Keywords.Values,
+	}
+	for _, keyword := range inst.KeywordObjects {
+		config.Keywords = append(config.Keywords, keyword.Name)
+	}
+	for _, p := range inst.Products {
+		config.Products = append(config.Products, Product{
+			Name:           p.Name,
+			Classification: p.Classification,
+			Description:    p.Description,
+			Components:     p.Components.names(),
+			Versions:       p.Versions.names(),
+			Milestones:     p.Milestones.names(),
+		})
+	}
+	for _, f := range inst.FlagTypes {
+		config.FlagTypes = append(config.FlagTypes, FlagType{
+			ID:                      f.ID,
+			Name:                    f.Name,
+			Description:             f.Description,
+			Type:                    f.Type,
+			Requestable:             f.Requestable == 1,
+			SpecificallyRequestable: f.SpecificallyRequestable == 1,
+			Multiplicable:           f.Multiplicable == 1,
+		})
+	}
+
+	// the legal values of custom select fields come as elements named
+	// after the field
+	legal := make(map[string][]string)
+	for _, extra := range inst.Extra {
+		if strings.HasPrefix(extra.XMLName.Local, "cf_") {
+			legal[extra.XMLName.Local] = extra.Values
+		}
+	}
+	for _, f := range inst.Fields {
+		field := Field{
+			Name:        f.Name,
+			Description: f.Description,
+			Type:        f.Type,
+			Custom:      f.Custom == 1,
+			LegalValues: f.LegalValues.Values,
+		}
+		if field.LegalValues == nil {
+			field.LegalValues = legal[f.Name]
+		}
+		config.Fields = append(config.Fields, field)
+	}
+
+	return config, nil
+}
+
+func (c *Client) decodeConfiguration(data []byte) (*Configuration, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return c.GetConfigurationFromJSON(bytes.NewReader(trimmed))
+	}
+	return decodeConfigurationRDF(data)
+}
+
+func (c *Client) cacheConfiguration(config *Configuration) {
+	if c.cacher == nil {
+		return
+	}
+	b, err := json.Marshal(config)
+	if err == nil {
+		writer := c.cacher.GetWriter("configuration")
+		writer.Write(b)
+		writer.Close()
+	}
+}
+
+// GetConfiguration gets the legal values for the fields of the Bugzilla
+// instance from config.cgi. The result is kept in the Client, so only the
+// first call hits the server. Once loaded, it is also used by Update() to
+// validate Changes.
+func (c *Client) GetConfiguration() (*Configuration, error) {
+	if config := c.loadedConfiguration(); config != nil {
+		return config, nil
+	}
+
+	url, err := c.getURL("config.cgi", map[string]string{"ctype": "rdf"})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.getBody(url)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := c.decodeConfiguration(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cacheConfiguration(config)
+	c.SetConfiguration(config)
+	return config, nil
+}
+
+// GetConfigurationFromJSON gets a *Configuration from a JSON blob, such as
+// one stored by the Cacher
+func (c *Client) GetConfigurationFromJSON(source io.Reader) (*Configuration, error) {
+	var config Configuration
+	decoder := json.NewDecoder(source)
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// SetConfiguration makes the Client use config instead of fetching it from
+// the server, for example when it was loaded from a cache
+func (c *Client) SetConfiguration(config *Configuration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configuration = config
+}
+
+func (c *Client) loadedConfiguration() *Configuration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.configuration
+}
+
+// Product finds a product by name
+func (config *Configuration) Product(name string) (*Product, bool) {
+	for i := range config.Products {
+		if config.Products[i].Name == name {
+			return &config.Products[i], true
+		}
+	}
+	return nil, false
+}
+
+// Field finds a field by name
+func (config *Configuration) Field(name string) (*Field, bool) {
+	for i := range config.Fields {
+		if config.Fields[i].Name == name {
+			return &config.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// PriorityMap maps the short priority names to the ones used by the server,
+// in the same way as the PriorityMap variable. A priority such as
+// "P1 - Urgent" is mapped from both "P1" and "P1 - Urgent".
+func (config *Configuration) PriorityMap() map[string]string {
+	priorities := make(map[string]string)
+	for _, priority := range config.Priorities {
+		priorities[priority] = priority
+		short := strings.TrimSpace(strings.SplitN(priority, " - ", 2)[0])
+		if _, ok := priorities[short]; !ok {
+			priorities[short] = priority
+		}
+	}
+	return priorities
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValue checks value against the legal values, ignoring the check when
+// the server didn't provide any
+func checkValue(name string, legal []string, value string) error {
+	if value == "" || len(legal) == 0 || contains(legal, value) {
+		return nil
+	}
+	return InvalidValueError{name, value}
+}
+
+// versions lists the versions of product, or of all the products when it
+// is not known
+func (config *Configuration) versions(product string) []string {
+	if p, ok := config.Product(product); ok {
+		return p.Versions
+	}
+	var versions []string
+	for _, p := range config.Products {
+		for _, version := range p.Versions {
+			if !contains(versions, version) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	return versions
+}
+
+// validate checks changes against the legal values. The version is checked
+// against the ones of product, or of any product when product is empty.
+func (config *Configuration) validate(changes *Changes, product string) error {
+	checks := []struct {
+		name  string
+		legal []string
+		value string
+	}{
+		{"bug_status", config.Statuses, changes.SetStatus},
+		{"resolution", config.Resolutions, changes.SetResolution},
+		{"bug_severity", config.Severities, changes.SetSeverity},
+		{"rep_platform", config.Platforms, changes.SetPlatform},
+		{"op_sys", config.OpSys, changes.SetOpSys},
+		{"version", config.versions(product), changes.SetVersion},
+	}
+	for _, check := range checks {
+		if err := checkValue(check.name, check.legal, check.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// priorityMap is the mapping used to translate Changes.SetPriority
+func (c *Client) priorityMap() map[string]string {
+	if config := c.loadedConfiguration(); config != nil && len(config.Priorities) > 0 {
+		return config.PriorityMap()
+	}
+	return PriorityMap
+}
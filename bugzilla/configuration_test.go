@@ -0,0 +1,305 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const configRDF = `<?xml version="1.0" encoding="UTF-8"?>
+<RDF xmlns="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+     xmlns:bz="http://www.bugzilla.org/rdf#"
+     xmlns:nc="http://home.netscape.com/NC-rdf#">
+
+<bz:installation rdf:about="http://bugzilla.foobar.com/">
+  <bz:install_version>4.4.12</bz:install_version>
+  <bz:maintainer>maintainer@foobar.com</bz:maintainer>
+
+  <bz:status>
+    <Seq>
+      <li>NEW</li>
+      <li>CONFIRMED</li>
+      <li>IN_PROGRESS</li>
+      <li>REOPENED</li>
+      <li>RESOLVED</li>
+      <li>VERIFIED</li>
+    </Seq>
+  </bz:status>
+
+  <bz:status_open>
+    <Seq>
+      <li>NEW</li>
+      <li>CONFIRMED</li>
+      <li>IN_PROGRESS</li>
+      <li>REOPENED</li>
+    </Seq>
+  </bz:status_open>
+
+  <bz:status_closed>
+    <Seq>
+      <li>RESOLVED</li>
+      <li>VERIFIED</li>
+    </Seq>
+  </bz:status_closed>
+
+  <bz:resolution>
+    <Seq>
+      <li></li>
+      <li>FIXED</li>
+      <li>INVALID</li>
+      <li>WONTFIX</li>
+      <li>DUPLICATE</li>
+    </Seq>
+  </bz:resolution>
+
+  <bz:keyword>
+    <Seq>
+      <li>FIRST_KEYWORD</li>
+      <li>SECOND_KEYWORD</li>
+    </Seq>
+  </bz:keyword>
+
+  <bz:platform>
+    <Seq>
+      <li>All</li>
+      <li>aarch64</li>
+      <li>Other</li>
+    </Seq>
+  </bz:platform>
+
+  <bz:op_sys>
+    <Seq>
+      <li>All</li>
+      <li>Other</li>
+    </Seq>
+  </bz:op_sys>
+
+  <bz:priority>
+    <Seq>
+      <li>P1 - Highest</li>
+      <li>P2 - Normal</li>
+      <li>P3 - Lowest</li>
+    </Seq>
+  </bz:priority>
+
+  <bz:severity>
+    <Seq>
+      <li>Critical</li>
+      <li>Normal</li>
+      <li>Enhancement</li>
+    </Seq>
+  </bz:severity>
+
+  <bz:cf_blocker>
+    <Seq>
+      <li>---</li>
+      <li>Yes</li>
+      <li>No</li>
+    </Seq>
+  </bz:cf_blocker>
+
+  <bz:products>
+    <Seq>
+      <li>
+        <bz:product rdf:about="http://bugzilla.foobar.com/product.cgi?name=Frobnicator">
+          <bz:name>Frobnicator</bz:name>
+          <bz:classification>foobar Tools</bz:classification>
+          <bz:description>The frobnicator</bz:description>
+          <bz:components>
+            <Seq>
+              <li resource="http://bugzilla.foobar.com/component.cgi?name=Core&amp;product=Frobnicator"/>
+              <li resource="http://bugzilla.foobar.com/component.cgi?name=Frob%20Tool&amp;product=Frobnicator"/>
+            </Seq>
+          </bz:components>
+          <bz:versions>
+            <Seq>
+              <li resource="http://bugzilla.foobar.com/version.cgi?name=GM&amp;product=Frobnicator"/>
+            </Seq>
+          </bz:versions>
+          <bz:target_milestones>
+            <Seq>
+              <li resource="http://bugzilla.foobar.com/milestone.cgi?name=---&amp;product=Frobnicator"/>
+            </Seq>
+          </bz:target_milestones>
+        </bz:product>
+      </li>
+    </Seq>
+  </bz:products>
+
+  <bz:fields>
+    <Seq>
+      <li>
+        <bz:field rdf:about="http://bugzilla.foobar.com/field.cgi?name=bug_status">
+          <bz:name>bug_status</bz:name>
+          <bz:description>Status</bz:description>
+          <bz:type>2</bz:type>
+          <bz:custom>0</bz:custom>
+        </bz:field>
+      </li>
+      <li>
+        <bz:field rdf:about="http://bugzilla.foobar.com/field.cgi?name=cf_blocker">
+          <bz:name>cf_blocker</bz:name>
+          <bz:description>Blocker</bz:description>
+          <bz:type>2</bz:type>
+          <bz:custom>1</bz:custom>
+        </bz:field>
+      </li>
+    </Seq>
+  </bz:fields>
+
+  <bz:flag_types>
+    <Seq>
+      <li>
+        <bz:flag_type rdf:about="http://bugzilla.foobar.com/flag.cgi?id=4&amp;name=needinfo">
+          <bz:id>4</bz:id>
+          <bz:name>needinfo</bz:name>
+          <bz:description>Need more information</bz:description>
+          <bz:type>bug</bz:type>
+          <bz:requestable>1</bz:requestable>
+          <bz:specifically_requestable>1</bz:specifically_requestable>
+          <bz:multiplicable>1</bz:multiplicable>
+        </bz:flag_type>
+      </li>
+    </Seq>
+  </bz:flag_types>
+</bz:installation>
+
+</RDF>
+`
+
+func (cs *clientSuite) TestGetConfiguration(c *C) {
+	requests := 0
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config.cgi":
+			requests++
+			c.Assert(r.URL.Query().Get("ctype"), Equals, "rdf")
+			io.WriteString(w, configRDF)
+		default:
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+	}))
+	defer ts0.Close()
+
+	var cacher CacherHelper
+	bz := makeClientWithCache(ts0.URL, &cacher)
+	config, err := bz.GetConfiguration()
+	c.Assert(err, IsNil)
+	c.Check(config.Version, Equals, "4.4.12")
+	c.Check(config.Statuses, DeepEquals, []string{"NEW", "CONFIRMED", "IN_PROGRESS", "REOPENED", "RESOLVED", "VERIFIED"})
+	c.Check(config.OpenStatuses, DeepEquals, []string{"NEW", "CONFIRMED", "IN_PROGRESS", "REOPENED"})
+	c.Check(config.ClosedStatuses, DeepEquals, []string{"RESOLVED", "VERIFIED"})
+	c.Check(config.Resolutions, DeepEquals, []string{"", "FIXED", "INVALID", "WONTFIX", "DUPLICATE"})
+	c.Check(config.Keywords, DeepEquals, []string{"FIRST_KEYWORD", "SECOND_KEYWORD"})
+	c.Check(config.Platforms, DeepEquals, []string{"All", "aarch64", "Other"})
+	c.Check(config.OpSys, DeepEquals, []string{"All", "Other"})
+	c.Check(config.Priorities, DeepEquals, []string{"P1 - Highest", "P2 - Normal", "P3 - Lowest"})
+	c.Check(config.Severities, DeepEquals, []string{"Critical", "Normal", "Enhancement"})
+
+	c.Assert(len(config.Products), Equals, 1)
+	product, ok := config.Product("Frobnicator")
+	c.Assert(ok, Equals, true)
+	c.Check(product.Classification, Equals, "foobar Tools")
+	c.Check(product.Components, DeepEquals, []string{"Core", "Frob Tool"})
+	c.Check(product.Versions, DeepEquals, []string{"GM"})
+	c.Check(product.Milestones, DeepEquals, []string{"---"})
+
+	c.Assert(len(config.FlagTypes), Equals, 1)
+	c.Check(config.FlagTypes[0], DeepEquals, bugzilla.FlagType{ID: 4, Name: "needinfo",
+		Description: "Need more information", Type: "bug", Requestable: true,
+		SpecificallyRequestable: true, Multiplicable: true})
+
+	field, ok := config.Field("cf_blocker")
+	c.Assert(ok, Equals, true)
+	c.Check(field.Custom, Equals, true)
+	c.Check(field.LegalValues, DeepEquals, []string{"---", "Yes", "No"})
+	field, ok = config.Field("bug_status")
+	c.Assert(ok, Equals, true)
+	c.Check(field.Custom, Equals, false)
+
+	c.Check(config.PriorityMap()["P2"], Equals, "P2 - Normal")
+	c.Check(config.PriorityMap()["P2 - Normal"], Equals, "P2 - Normal")
+
+	// cached in the client and in the Cacher
+	_, err = bz.GetConfiguration()
+	c.Assert(err, IsNil)
+	c.Check(requests, Equals, 1)
+	c.Check(cacher.id, Equals, "configuration")
+	cached, err := bz.GetConfigurationFromJSON(&cacher.buf)
+	c.Assert(err, IsNil)
+	c.Check(cached, DeepEquals, config)
+}
+
+func (cs *clientSuite) TestGetConfigurationJSON(c *C) {
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"statuses": ["NEW", "RESOLVED"], "priorities": ["High", "Low"]}`)
+	}))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	config, err := bz.GetConfiguration()
+	c.Assert(err, IsNil)
+	c.Check(config.Statuses, DeepEquals, []string{"NEW", "RESOLVED"})
+	c.Check(config.PriorityMap(), DeepEquals, map[string]string{"High": "High", "Low": "Low"})
+}
+
+func (cs *clientSuite) TestUpdateWithConfiguration(c *C) {
+	queries := make(chan url.Values, 10)
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config.cgi":
+			io.WriteString(w, configRDF)
+		case "/show_bug.cgi":
+			io.WriteString(w, strings.Replace(showBugHtml, "P1 - Urgent", "P1 - Highest", -1))
+		case "/process_bug.cgi":
+			r.ParseForm()
+			queries <- r.Form
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+	}))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.GetConfiguration()
+	c.Assert(err, IsNil)
+
+	_, err = bz.Update(101234, bugzilla.Changes{SetPriority: "P1"})
+	c.Assert(err, IsNil)
+	query := <-queries
+	c.Check(query.Get("priority"), Equals, "P1 - Highest")
+
+	_, err = bz.Update(101234, bugzilla.Changes{SetPriority: "P0"})
+	c.Assert(err, ErrorMatches, ".*invalid priority value.*")
+	c.Assert(err, Equals, bugzilla.InvalidValueError{Field: "priority", Value: "P0"})
+
+	_, err = bz.Update(101234, bugzilla.Changes{SetStatus: "ASSIGNED"})
+	c.Assert(err, ErrorMatches, ".*invalid bug_status value: ASSIGNED.*")
+	c.Assert(err, Equals, bugzilla.InvalidValueError{Field: "bug_status", Value: "ASSIGNED"})
+
+	_, err = bz.Update(101234, bugzilla.Changes{SetResolution: "NORESPONSE"})
+	c.Assert(err, ErrorMatches, ".*invalid resolution value.*")
+
+	// the version is checked against the ones of the products
+	_, err = bz.Update(101234, bugzilla.Changes{SetVersion: "Milestone 9"})
+	c.Assert(err, Equals, bugzilla.InvalidValueError{Field: "version", Value: "Milestone 9"})
+	_, err = bz.Update(101234, bugzilla.Changes{SetVersion: "GM"})
+	c.Assert(err, IsNil)
+	query = <-queries
+	c.Check(query.Get("version"), Equals, "GM")
+
+	_, err = bz.Update(101234, bugzilla.Changes{SetStatus: "RESOLVED", SetResolution: "FIXED"})
+	c.Assert(err, IsNil)
+	query = <-queries
+	c.Check(query.Get("bug_status"), Equals, "RESOLVED")
+	c.Check(query.Get("resolution"), Equals, "FIXED")
+	c.Check(len(queries), Equals, 0)
+}
@@ -0,0 +1,239 @@
+package bugzilla
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CVSS is a CVSS score as written in the status whiteboard of security
+// bugs, as in "CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)".
+// Source is who scored it, as in SUSE or NVD, and Vector is written without
+// the parentheses.
+type CVSS struct {
+	Version string  `json:"version"`
+	Source  string  `json:"source"`
+	CVE     string  `json:"cve"`
+	Score   float64 `json:"score"`
+	Vector  string  `json:"vector"`
+}
+
+var cvssTokenRe = regexp.MustCompile(`^CVSSv(\d+(?:\.\d+)?):([^:]+):([^:]+):(\d+(?:\.\d+)?):\((.*)\)$`)
+
+// cvssMetrics has the legal values of the metrics of a version of CVSS,
+// and which of them are required
+type cvssMetrics struct {
+	required map[string][]string
+	optional map[string][]string
+}
+
+var cvss2Metrics = cvssMetrics{
+	required: map[string][]string{
+		"AV": {"L", "A", "N"}, "AC": {"H", "M", "L"}, "Au": {"M", "S", "N"},
+		"C": {"N", "P", "C"}, "I": {"N", "P", "C"}, "A": {"N", "P", "C"},
+	},
+	optional: map[string][]string{
+		"E":   {"U", "POC", "F", "H", "ND"},
+		"RL":  {"OF", "TF", "W", "U", "ND"},
+		"RC":  {"UC", "UR", "C", "ND"},
+		"CDP": {"N", "L", "LM", "MH", "H", "ND"},
+		"TD":  {"N", "L", "M", "H", "ND"},
+		"CR":  {"L", "M", "H", "ND"}, "IR": {"L", "M", "H", "ND"}, "AR": {"L", "M", "H", "ND"},
+	},
+}
+
+var cvss3Metrics = cvssMetrics{
+	required: map[string][]string{
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "PR": {"N", "L", "H"}, "UI": {"N", "R"},
+		"S": {"U", "C"}, "C": {"H", "L", "N"}, "I": {"H", "L", "N"}, "A": {"H", "L", "N"},
+	},
+	optional: map[string][]string{
+		"E": {"X", "U", "P", "F", "H"}, "RL": {"X", "O", "T", "W", "U"}, "RC": {"X", "U", "R", "C"},
+		"CR": {"X", "L", "M", "H"}, "IR": {"X", "L", "M", "H"}, "AR": {"X", "L", "M", "H"},
+		"MAV": {"X", "N", "A", "L", "P"}, "MAC": {"X", "L", "H"}, "MPR": {"X", "N", "L", "H"},
+		"MUI": {"X", "N", "R"}, "MS": {"X", "U", "C"},
+		"MC": {"X", "N", "L", "H"}, "MI": {"X", "N", "L", "H"}, "MA": {"X", "N", "L", "H"},
+	},
+}
+
+var cvss4Metrics = cvssMetrics{
+	required: map[string][]string{
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "AT": {"N", "P"}, "PR": {"N", "L", "H"},
+		"UI": {"N", "P", "A"}, "VC": {"H", "L", "N"}, "VI": {"H", "L", "N"}, "VA": {"H", "L", "N"},
+		"SC": {"H", "L", "N"}, "SI": {"H", "L", "N"}, "SA": {"H", "L", "N"},
+	},
+	optional: map[string][]string{
+		// threat and environmental metrics
+		"E": {"X", "A", "P", "U"}, "CR": {"X", "H", "M", "L"}, "IR": {"X", "H", "M", "L"},
+		"AR": {"X", "H", "M", "L"}, "MAV": {"X", "N", "A", "L", "P"}, "MAC": {"X", "L", "H"},
+		"MAT": {"X", "N", "P"}, "MPR": {"X", "N", "L", "H"}, "MUI": {"X", "N", "P", "A"},
+		"MVC": {"X", "H", "L", "N"}, "MVI": {"X", "H", "L", "N"}, "MVA": {"X", "H", "L", "N"},
+		"MSC": {"X", "H", "L", "N"}, "MSI": {"X", "S", "H", "L", "N"}, "MSA": {"X", "S", "H", "L", "N"},
+		// supplemental metrics
+		"S": {"X", "N", "P"}, "AU": {"X", "N", "Y"}, "R": {"X", "A", "U", "I"},
+		"V": {"X", "D", "C"}, "RE": {"X", "L", "M", "H"}, "U": {"X", "Clear", "Green", "Amber", "Red"},
+	},
+}
+
+// ParseCVSS reads a CVSS token of the status whiteboard and validates it
+func ParseCVSS(token string) (CVSS, error) {
+	match := cvssTokenRe.FindStringSubmatch(token)
+	if match == nil {
+		return CVSS{}, fmt.Errorf("invalid CVSS token %q", token)
+	}
+	score, err := strconv.ParseFloat(match[4], 64)
+	if err != nil {
+		return CVSS{}, fmt.Errorf("invalid CVSS token %q: bad score", token)
+	}
+	cvss := CVSS{Version: match[1], Source: match[2], CVE: match[3], Score: score, Vector: match[5]}
+	if err = cvss.Validate(); err != nil {
+		return CVSS{}, fmt.Errorf("invalid CVSS token %q: %v", token, err)
+	}
+	return cvss, nil
+}
+
+// Validate checks the score and that the vector has all the metrics
+// required by the version, with legal values and no repetitions. The
+// vectors of CVSS 3 and 4 can start with the version, as in "CVSS:3.1/".
+func (c *CVSS) Validate() error {
+	var metrics cvssMetrics
+	prefix := ""
+	switch c.Version {
+	case "2":
+		metrics = cvss2Metrics
+	case "3.0", "3.1":
+		metrics, prefix = cvss3Metrics, "CVSS:"+c.Version+"/"
+	case "4.0":
+		metrics, prefix = cvss4Metrics, "CVSS:4.0/"
+	default:
+		return fmt.Errorf("unknown CVSS version %q", c.Version)
+	}
+	if c.Score < 0 || c.Score > 10 {
+		return fmt.Errorf("score %v out of range", c.Score)
+	}
+	if c.CVE == "" || c.Source == "" {
+		return fmt.Errorf("missing CVE or source")
+	}
+
+	vector := c.Vector
+	if prefix != "" {
+		vector = strings.TrimPrefix(vector, prefix)
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(vector, "/") {
+		fields := strings.SplitN(part, ":", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return fmt.Errorf("invalid metric %q", part)
+		}
+		name, value := fields[0], fields[1]
+		legal, ok := metrics.required[name]
+		if !ok {
+			legal, ok = metrics.optional[name]
+		}
+		if !ok {
+			return fmt.Errorf("unknown metric %s", name)
+		}
+		if !contains(legal, value) {
+			return fmt.Errorf("invalid value %s for metric %s", value, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("repeated metric %s", name)
+		}
+		seen[name] = true
+	}
+	for name := range metrics.required {
+		if !seen[name] {
+			return fmt.Errorf("missing metric %s", name)
+		}
+	}
+	return nil
+}
+
+// String formats the token as written in the status whiteboard
+func (c CVSS) String() string {
+	return fmt.Sprintf("CVSSv%s:%s:%s:%s:(%s)", c.Version, c.Source, c.CVE,
+		strconv.FormatFloat(c.Score, 'f', 1, 64), c.Vector)
+}
+
+// sameScore tells whether both tokens are the score of the same source for
+// the same CVE and version of CVSS
+func (c *CVSS) sameScore(other *CVSS) bool {
+	return c.Version == other.Version && c.Source == other.Source && c.CVE == other.CVE
+}
+
+// WhiteboardCVSS finds the CVSS tokens in the status whiteboard. The valid
+// ones are returned even when others are not, in which case the error
+// tells about the first invalid one.
+func WhiteboardCVSS(whiteboard string) ([]CVSS, error) {
+	scores := []CVSS{}
+	var firstErr error
+	for _, token := range strings.Fields(whiteboard) {
+		if !strings.HasPrefix(token, "CVSSv") {
+			continue
+		}
+		cvss, err := ParseCVSS(token)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = ErrBugzilla{err}
+			}
+			continue
+		}
+		scores = append(scores, cvss)
+	}
+	return scores, firstErr
+}
+
+// SetWhiteboardCVSS replaces the token of the same source, CVE and version
+// with cvss, or adds it at the end, leaving the rest of the whiteboard as
+// it was. A token with the same score and vector is kept as written, even
+// if String() would write the score differently, as "5.0" for "5".
+func SetWhiteboardCVSS(whiteboard string, cvss CVSS) (string, error) {
+	if err := cvss.Validate(); err != nil {
+		return "", RequestError{fmt.Errorf("invalid CVSS: %v", err)}
+	}
+	w := ParseWhiteboard(whiteboard)
+	same := func(token string) bool {
+		current, err := ParseCVSS(token)
+		return err == nil && current.sameScore(&cvss)
+	}
+	text := cvss.String()
+	for _, token := range w.tokens {
+		if same(token) {
+			if current, _ := ParseCVSS(token); current == cvss {
+				text = token
+			}
+			break
+		}
+	}
+	w.replace(same, text)
+	return w.String(), nil
+}
+
+// CVSSChanges prepares the Changes that set cvss in the status whiteboard
+// of bug, failing with a mid-air collision if the bug changed since it was
+// fetched
+func CVSSChanges(bug *Bug, cvss CVSS) (Changes, error) {
+	whiteboard, err := SetWhiteboardCVSS(bug.StatusWhiteboard, cvss)
+	if err != nil {
+		return Changes{}, err
+	}
+	if whiteboard == bug.StatusWhiteboard {
+		return Changes{}, nil
+	}
+	return Changes{SetWhiteboard: whiteboard, DeltaTS: bug.DeltaTS, CheckDeltaTS: true}, nil
+}
+
+// UpdateCVSS sets cvss in the status whiteboard of the bug id. The result
+// is nil when the token was already there.
+func (c *Client) UpdateCVSS(id int, cvss CVSS) (*UpdateResult, error) {
+	bug, err := c.GetBug(id)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := CVSSChanges(bug, cvss)
+	if err != nil || changes == (Changes{}) {
+		return nil, err
+	}
+	return c.Update(id, changes)
+}
@@ -0,0 +1,160 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const suseCVSS = "CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)"
+
+func (cs *clientSuite) TestParseCVSS(c *C) {
+	cvss, err := bugzilla.ParseCVSS(suseCVSS)
+	c.Assert(err, IsNil)
+	c.Assert(cvss, DeepEquals, bugzilla.CVSS{Version: "3.1", Source: "SUSE", CVE: "CVE-2021-3156",
+		Score: 7.8, Vector: "AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H"})
+	c.Assert(cvss.String(), Equals, suseCVSS)
+
+	cvss, err = bugzilla.ParseCVSS("CVSSv2:NVD:CVE-2014-0160:5:(AV:N/AC:L/Au:N/C:P/I:N/A:N)")
+	c.Assert(err, IsNil)
+	c.Assert(cvss.Score, Equals, 5.0)
+	c.Assert(cvss.String(), Equals, "CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N)")
+
+	_, err = bugzilla.ParseCVSS("CVSSv3.1:RedHat:CVE-2021-3156:7.8:(CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H/E:F)")
+	c.Assert(err, IsNil)
+	_, err = bugzilla.ParseCVSS("CVSSv4.0:SUSE:CVE-2024-1234:9.3:(CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N)")
+	c.Assert(err, IsNil)
+
+	valid := []string{
+		// CVSS 2 with all the temporal and environmental metrics
+		"CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N/E:POC/RL:OF/RC:UC/CDP:LM/TD:H/CR:M/IR:L/AR:ND)",
+		"CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N/E:ND/RL:TF/RC:UR/CDP:MH/TD:ND/CR:ND/IR:ND/AR:H)",
+		"CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N/E:H/RL:U/RC:C/CDP:ND)",
+		// CVSS 4 with the supplemental metrics
+		"CVSSv4.0:SUSE:CVE-2024-1234:9.3:(CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/S:P/AU:Y/R:A/V:C/RE:H/U:Red)",
+		"CVSSv4.0:SUSE:CVE-2024-1234:9.3:(CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/E:A/MSI:S/U:Clear)",
+		"CVSSv4.0:SUSE:CVE-2024-1234:9.3:(CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/U:Amber/S:N/AU:X)",
+	}
+	for _, token := range valid {
+		_, err = bugzilla.ParseCVSS(token)
+		c.Assert(err, IsNil, Commentf("token %s", token))
+	}
+
+	invalid := []struct{ token, err string }{
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8", `invalid CVSS token .*`},
+		{"CVSSv5:SUSE:CVE-2021-3156:7.8:(AV:L)", `.*unknown CVSS version "5"`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:17.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)", `.*score 17.8 out of range`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H)", `.*missing metric A`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:Q/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)", `.*invalid value Q for metric AV`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H/Au:N)", `.*unknown metric Au`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)", `.*repeated metric AV`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC/PR:L/UI:N/S:U/C:H/I:H/A:H)", `.*invalid metric "AC"`},
+		{"CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N/E:P)", `.*invalid value P for metric E`},
+		{"CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N/CDP:M)", `.*invalid value M for metric CDP`},
+		{"CVSSv3.1:SUSE:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H/E:POC)", `.*invalid value POC for metric E`},
+		{"CVSSv4.0:SUSE:CVE-2024-1234:9.3:(CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N/U:Blue)", `.*invalid value Blue for metric U`},
+	}
+	for _, test := range invalid {
+		_, err = bugzilla.ParseCVSS(test.token)
+		c.Assert(err, ErrorMatches, test.err, Commentf("token %s", test.token))
+	}
+}
+
+func (cs *clientSuite) TestWhiteboardCVSS(c *C) {
+	whiteboard := "wasL3:12345 " + suseCVSS + "  CVSSv3.1:NVD:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H) CVSSv3.1:SUSE:broken"
+	scores, err := bugzilla.WhiteboardCVSS(whiteboard)
+	c.Assert(err, ErrorMatches, `.*invalid CVSS token "CVSSv3.1:SUSE:broken"`)
+	c.Assert(scores, HasLen, 2)
+	c.Assert(scores[0].Source, Equals, "SUSE")
+	c.Assert(scores[1].Source, Equals, "NVD")
+
+	scores, err = bugzilla.WhiteboardCVSS("wasZZ:48626  zzz")
+	c.Assert(err, IsNil)
+	c.Assert(scores, HasLen, 0)
+}
+
+func (cs *clientSuite) TestSetWhiteboardCVSS(c *C) {
+	cvss, err := bugzilla.ParseCVSS(suseCVSS)
+	c.Assert(err, IsNil)
+
+	whiteboard, err := bugzilla.SetWhiteboardCVSS("wasZZ:48626  zzz", cvss)
+	c.Assert(err, IsNil)
+	c.Assert(whiteboard, Equals, "wasZZ:48626  zzz "+suseCVSS)
+
+	whiteboard, err = bugzilla.SetWhiteboardCVSS("", cvss)
+	c.Assert(err, IsNil)
+	c.Assert(whiteboard, Equals, suseCVSS)
+
+	// the scores of other sources are kept, the old one of SUSE is
+	// rewritten in place and repetitions go away
+	nvd := "CVSSv3.1:NVD:CVE-2021-3156:7.8:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H)"
+	old := "CVSSv3.1:SUSE:CVE-2021-3156:5.5:(AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N)"
+	whiteboard, err = bugzilla.SetWhiteboardCVSS("a:1 "+old+"  "+nvd+" "+old+" b:2", cvss)
+	c.Assert(err, IsNil)
+	c.Assert(whiteboard, Equals, "a:1 "+suseCVSS+"  "+nvd+" b:2")
+
+	// the same score written without decimals is left alone
+	v2 := "CVSSv2:NVD:CVE-2014-0160:5:(AV:N/AC:L/Au:N/C:P/I:N/A:N)"
+	heartbleed, err := bugzilla.ParseCVSS(v2)
+	c.Assert(err, IsNil)
+	c.Assert(heartbleed.String(), Equals, "CVSSv2:NVD:CVE-2014-0160:5.0:(AV:N/AC:L/Au:N/C:P/I:N/A:N)")
+	whiteboard, err = bugzilla.SetWhiteboardCVSS("a:1 "+v2, heartbleed)
+	c.Assert(err, IsNil)
+	c.Assert(whiteboard, Equals, "a:1 "+v2)
+	heartbleed.Score = 5.1
+	whiteboard, err = bugzilla.SetWhiteboardCVSS("a:1 "+v2, heartbleed)
+	c.Assert(err, IsNil)
+	c.Assert(whiteboard, Equals, "a:1 CVSSv2:NVD:CVE-2014-0160:5.1:(AV:N/AC:L/Au:N/C:P/I:N/A:N)")
+
+	cvss.Vector = "AV:L"
+	_, err = bugzilla.SetWhiteboardCVSS("", cvss)
+	c.Assert(err, ErrorMatches, ".*invalid CVSS: missing metric .*")
+}
+
+func (cs *clientSuite) TestUpdateCVSS(c *C) {
+	var posts []url.Values
+	whiteboard := "wasZZ:48626  zzz"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/show_bug.cgi" && r.URL.Query().Get("ctype") == "xml":
+			bug := strings.Replace(bugXml, "2019-03-27 10:45:20", "2019-03-28 11:40:39", -1)
+			io.WriteString(w, strings.Replace(bug, "wasZZ:48626  zzz", whiteboard, 1))
+		case r.URL.Path == "/show_bug.cgi":
+			io.WriteString(w, showBugHtml)
+		case r.URL.Path == "/process_bug.cgi":
+			r.ParseForm()
+			posts = append(posts, r.PostForm)
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	cvss, err := bugzilla.ParseCVSS(suseCVSS)
+	c.Assert(err, IsNil)
+	_, err = bz.UpdateCVSS(1047068, cvss)
+	c.Assert(err, IsNil)
+	c.Assert(posts, HasLen, 1)
+	c.Assert(posts[0].Get("status_whiteboard"), Equals, "wasZZ:48626  zzz "+suseCVSS)
+
+	// nothing is posted when the token is already there
+	whiteboard = "wasZZ:48626  zzz " + suseCVSS
+	result, err := bz.UpdateCVSS(1047068, cvss)
+	c.Assert(err, IsNil)
+	c.Assert(result, IsNil)
+	c.Assert(posts, HasLen, 1)
+
+	// nor when it only differs in how the score is written
+	whiteboard = "wasZZ:48626  zzz " + strings.Replace(suseCVSS, ":7.8:", ":7.80:", 1)
+	result, err = bz.UpdateCVSS(1047068, cvss)
+	c.Assert(err, IsNil)
+	c.Assert(result, IsNil)
+	c.Assert(posts, HasLen, 1)
+}
@@ -0,0 +1,238 @@
+package bugzilla
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DependencyNode is a bug in a DependencyGraph
+type DependencyNode struct {
+	ID         int    `json:"id"`
+	Status     string `json:"status"`
+	Resolution string `json:"resolution"`
+	Summary    string `json:"summary"`
+	AssignedTo string `json:"assigned_to"`
+	DependsOn  []int  `json:"depends_on"`
+	Blocks     []int  `json:"blocks"`
+	// Depth is the distance to the root bug: positive for bugs the root
+	// depends on, negative for the bugs it blocks
+	Depth int `json:"depth"`
+	// Error is set when the bug could not be fetched (e.g. NotPermitted)
+	Error string `json:"error,omitempty"`
+}
+
+// IsOpen tells whether the bug has not been resolved yet
+func (n *DependencyNode) IsOpen() bool {
+	return n.Error == "" && n.Resolution == ""
+}
+
+// DependencyEdge means that the bug From depends on the bug To
+type DependencyEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// DependencyGraph has the bugs related to Root through dependson and
+// blocked
+type DependencyGraph struct {
+	Root  int                     `json:"root"`
+	Nodes map[int]*DependencyNode `json:"-"`
+}
+
+func newDependencyNode(bug *Bug, depth int) *DependencyNode {
+	return &DependencyNode{
+		ID:         bug.BugID,
+		Status:     bug.BugStatus,
+		Resolution: bug.Resolution,
+		Summary:    bug.ShortDesc,
+		AssignedTo: bug.AssignedTo.Email,
+		DependsOn:  bug.DependsOn,
+		Blocks:     bug.Blocks,
+		Depth:      depth,
+	}
+}
+
+// fetchBatch is the number of bugs fetched with a single GetBugs() call,
+// which has all of them in the URL
+const fetchBatch = 100
+
+// getBugsInBatches calls GetBugs() for a few bugs at a time, so that the
+// URLs are not too long for the server or the proxies in between
+func (c *Client) getBugsInBatches(ids []int) ([]*Bug, []BugError, error) {
+	var bugs []*Bug
+	var bugErrors []BugError
+	for start := 0; start < len(ids); start += fetchBatch {
+		end := start + fetchBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, batchErrors, err := c.GetBugs(ids[start:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		bugs = append(bugs, batch...)
+		bugErrors = append(bugErrors, batchErrors...)
+	}
+	return bugs, bugErrors, nil
+}
+
+// walkDependencies fetches the bugs level by level, following the links
+// returned by next, up to maxDepth levels (unlimited when zero)
+func (c *Client) walkDependencies(graph *DependencyGraph, maxDepth, direction int, next func(*DependencyNode) []int) error {
+	level := next(graph.Nodes[graph.Root])
+	for depth := 1; len(level) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+		var ids []int
+		for _, id := range level {
+			if _, seen := graph.Nodes[id]; !seen {
+				ids = append(ids, id)
+				graph.Nodes[id] = nil
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		bugs, bugErrors, err := c.getBugsInBatches(ids)
+		if err != nil {
+			return err
+		}
+		level = nil
+		for _, bug := range bugs {
+			node := newDependencyNode(bug, depth*direction)
+			graph.Nodes[bug.BugID] = node
+			level = append(level, next(node)...)
+		}
+		for _, bugError := range bugErrors {
+			graph.Nodes[bugError.ID] = &DependencyNode{ID: bugError.ID, Depth: depth * direction, Error: bugError.Code}
+		}
+		for _, id := range ids {
+			if graph.Nodes[id] == nil {
+				graph.Nodes[id] = &DependencyNode{ID: id, Depth: depth * direction, Error: "Missing"}
+			}
+		}
+	}
+	return nil
+}
+
+// GetDependencyTree builds the graph of the bugs the bug id depends on and
+// of the bugs it blocks, up to maxDepth levels in each direction (zero
+// means no limit). Each level is fetched with a request for every
+// fetchBatch bugs.
+func (c *Client) GetDependencyTree(id int, maxDepth int) (*DependencyGraph, error) {
+	root, err := c.GetBug(id)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &DependencyGraph{Root: id, Nodes: map[int]*DependencyNode{id: newDependencyNode(root, 0)}}
+	dependsOn := func(n *DependencyNode) []int { return n.DependsOn }
+	blocks := func(n *DependencyNode) []int { return n.Blocks }
+	if err = c.walkDependencies(graph, maxDepth, 1, dependsOn); err != nil {
+		return nil, err
+	}
+	if err = c.walkDependencies(graph, maxDepth, -1, blocks); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// Sorted returns the nodes sorted by ID
+func (g *DependencyGraph) Sorted() []*DependencyNode {
+	nodes := make([]*DependencyNode, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Edges returns the dependencies between the bugs in the graph
+func (g *DependencyGraph) Edges() []DependencyEdge {
+	seen := make(map[DependencyEdge]bool)
+	var edges []DependencyEdge
+	add := func(edge DependencyEdge) {
+		_, hasFrom := g.Nodes[edge.From]
+		_, hasTo := g.Nodes[edge.To]
+		if hasFrom && hasTo && !seen[edge] {
+			seen[edge] = true
+			edges = append(edges, edge)
+		}
+	}
+	for _, node := range g.Sorted() {
+		for _, id := range node.DependsOn {
+			add(DependencyEdge{From: node.ID, To: id})
+		}
+		for _, id := range node.Blocks {
+			add(DependencyEdge{From: id, To: node.ID})
+		}
+	}
+	return edges
+}
+
+// OpenDependencies lists the open bugs the root bug depends on, directly or
+// not
+func (g *DependencyGraph) OpenDependencies() []*DependencyNode {
+	var nodes []*DependencyNode
+	for _, node := range g.Sorted() {
+		if node.Depth > 0 && node.IsOpen() {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// MarshalJSON encodes the graph as its nodes and edges
+func (g *DependencyGraph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Root  int               `json:"root"`
+		Nodes []*DependencyNode `json:"nodes"`
+		Edges []DependencyEdge  `json:"edges"`
+	}{g.Root, g.Sorted(), g.Edges()})
+}
+
+// WriteJSON writes the graph as JSON
+func (g *DependencyGraph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g)
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format. Closed bugs are
+// drawn dashed and the root bug in bold.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(fmt.Sprintf("bug %d", g.Root)))
+	for _, node := range g.Sorted() {
+		label := fmt.Sprintf("%d %s", node.ID, node.Error)
+		if node.Error == "" {
+			label = fmt.Sprintf("%d %s %s\n%s\n%s", node.ID, node.Status, node.Resolution,
+				node.Summary, node.AssignedTo)
+		}
+		var style []string
+		if !node.IsOpen() {
+			style = append(style, "dashed")
+		}
+		if node.ID == g.Root {
+			style = append(style, "bold")
+		}
+		attrs := "label=" + dotQuote(strings.Replace(label, " \n", "\n", -1))
+		if len(style) > 0 {
+			attrs += ", style=" + dotQuote(strings.Join(style, ","))
+		}
+		fmt.Fprintf(&b, "  %d [%s];\n", node.ID, attrs)
+	}
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(&b, "  %d -> %d;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,183 @@
+package bugzilla_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+type treeBug struct {
+	status     string
+	resolution string
+	summary    string
+	dependsOn  []int
+	blocked    []int
+	error      string
+}
+
+var dependencyTree = map[int]treeBug{
+	1:  {status: "NEW", summary: "Tracker", dependsOn: []int{2, 3}, blocked: []int{10}},
+	2:  {status: "IN_PROGRESS", summary: "First blocker", dependsOn: []int{4}, blocked: []int{1}},
+	3:  {status: "RESOLVED", resolution: "FIXED", summary: `"Second" blocker`, dependsOn: []int{4, 5}, blocked: []int{1}},
+	4:  {status: "NEW", summary: "Deep blocker", blocked: []int{2, 3}},
+	5:  {error: "NotPermitted"},
+	10: {status: "NEW", summary: "Release", dependsOn: []int{1}},
+}
+
+func treeBugXML(id int) string {
+	bug := dependencyTree[id]
+	if bug.error != "" {
+		return fmt.Sprintf(`<bug error="%s"><bug_id>%d</bug_id></bug>`, bug.error, id)
+	}
+	xml := fmt.Sprintf(`<bug><bug_id>%d</bug_id><short_desc>%s</short_desc>
+<bug_status>%s</bug_status><resolution>%s</resolution>
+<assigned_to name="Firstname Lastname">user%d@foobar.com</assigned_to>`,
+		id, strings.Replace(bug.summary, `"`, "&quot;", -1), bug.status, bug.resolution, id)
+	for _, dep := range bug.dependsOn {
+		xml += fmt.Sprintf("<dependson>%d</dependson>", dep)
+	}
+	for _, blocked := range bug.blocked {
+		xml += fmt.Sprintf("<blocked>%d</blocked>", blocked)
+	}
+	return xml + "</bug>"
+}
+
+func treeServer(requests *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/show_bug.cgi" || r.URL.Query().Get("ctype") != "xml" {
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+		ids := r.URL.Query()["id"]
+		*requests = append(*requests, ids)
+		io.WriteString(w, `<?xml version="1.0"?><bugzilla version="4.4.12">`)
+		for _, raw := range ids {
+			id, _ := strconv.Atoi(raw)
+			io.WriteString(w, treeBugXML(id))
+		}
+		io.WriteString(w, "</bugzilla>")
+	}))
+}
+
+func (cs *clientSuite) TestGetBugs(c *C) {
+	var requests [][]string
+	ts0 := treeServer(&requests)
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	bugs, bugErrors, err := bz.GetBugs([]int{2, 5, 3})
+	c.Assert(err, IsNil)
+	c.Check(requests, DeepEquals, [][]string{{"2", "5", "3"}})
+	c.Assert(bugs, HasLen, 2)
+	c.Check(bugs[0].BugID, Equals, 2)
+	c.Check(bugs[0].DependsOn, DeepEquals, []int{4})
+	c.Check(bugs[0].Blocks, DeepEquals, []int{1})
+	c.Check(bugs[1].BugID, Equals, 3)
+	c.Check(bugs[1].ShortDesc, Equals, `"Second" blocker`)
+	c.Check(bugErrors, DeepEquals, []bugzilla.BugError{{ID: 5, Code: "NotPermitted"}})
+	c.Check(bugErrors[0], ErrorMatches, "cannot get bug 5: NotPermitted")
+}
+
+func (cs *clientSuite) TestGetDependencyTree(c *C) {
+	var requests [][]string
+	ts0 := treeServer(&requests)
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	graph, err := bz.GetDependencyTree(1, 0)
+	c.Assert(err, IsNil)
+	c.Check(requests, DeepEquals, [][]string{{"1"}, {"2", "3"}, {"4", "5"}, {"10"}})
+	c.Assert(graph.Nodes, HasLen, 6)
+	c.Check(graph.Nodes[1].Depth, Equals, 0)
+	c.Check(graph.Nodes[4].Depth, Equals, 2)
+	c.Check(graph.Nodes[4].AssignedTo, Equals, "user4@foobar.com")
+	c.Check(graph.Nodes[5].Error, Equals, "NotPermitted")
+	c.Check(graph.Nodes[10].Depth, Equals, -1)
+
+	var open []int
+	for _, node := range graph.OpenDependencies() {
+		open = append(open, node.ID)
+	}
+	c.Check(open, DeepEquals, []int{2, 4})
+
+	var dot bytes.Buffer
+	err = graph.WriteDOT(&dot)
+	c.Assert(err, IsNil)
+	c.Check(dot.String(), Equals, `digraph "bug 1" {
+  1 [label="1 NEW\nTracker\nuser1@foobar.com", style="bold"];
+  2 [label="2 IN_PROGRESS\nFirst blocker\nuser2@foobar.com"];
+  3 [label="3 RESOLVED FIXED\n\"Second\" blocker\nuser3@foobar.com", style="dashed"];
+  4 [label="4 NEW\nDeep blocker\nuser4@foobar.com"];
+  5 [label="5 NotPermitted", style="dashed"];
+  10 [label="10 NEW\nRelease\nuser10@foobar.com"];
+  1 -> 2;
+  1 -> 3;
+  10 -> 1;
+  2 -> 4;
+  3 -> 4;
+  3 -> 5;
+}
+`)
+
+	var buf bytes.Buffer
+	err = graph.WriteJSON(&buf)
+	c.Assert(err, IsNil)
+	var decoded struct {
+		Root  int                       `json:"root"`
+		Nodes []bugzilla.DependencyNode `json:"nodes"`
+		Edges []bugzilla.DependencyEdge `json:"edges"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	c.Assert(err, IsNil)
+	c.Check(decoded.Root, Equals, 1)
+	c.Check(decoded.Nodes, HasLen, 6)
+	c.Check(decoded.Nodes[2].Summary, Equals, `"Second" blocker`)
+	c.Check(decoded.Edges, HasLen, 6)
+	c.Check(decoded.Edges[2], Equals, bugzilla.DependencyEdge{From: 10, To: 1})
+}
+
+func (cs *clientSuite) TestGetDependencyTreeMaxDepth(c *C) {
+	var requests [][]string
+	ts0 := treeServer(&requests)
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	graph, err := bz.GetDependencyTree(1, 1)
+	c.Assert(err, IsNil)
+	c.Check(requests, DeepEquals, [][]string{{"1"}, {"2", "3"}, {"10"}})
+	c.Check(graph.Nodes, HasLen, 4)
+}
+
+func (cs *clientSuite) TestGetDependencyTreeBatches(c *C) {
+	var requests [][]string
+	ts0 := treeServer(&requests)
+	defer ts0.Close()
+
+	// a tracker with too many blockers for a single URL
+	tracker := treeBug{status: "NEW", summary: "Big tracker"}
+	for id := 1000; id < 1250; id++ {
+		tracker.dependsOn = append(tracker.dependsOn, id)
+	}
+	dependencyTree[999] = tracker
+	defer delete(dependencyTree, 999)
+
+	graph, err := makeClient(ts0.URL).GetDependencyTree(999, 1)
+	c.Assert(err, IsNil)
+	c.Assert(graph.Nodes, HasLen, 251)
+	c.Check(graph.Nodes[1249].Depth, Equals, 1)
+
+	var sizes []int
+	for _, ids := range requests {
+		sizes = append(sizes, len(ids))
+	}
+	c.Check(sizes, DeepEquals, []int{1, 100, 100, 50})
+	c.Check(requests[2][0], Equals, "1100")
+}
@@ -0,0 +1,296 @@
+package bugzilla
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FieldChange is a change of a single valued field, named as in the
+// Bugzilla forms
+type FieldChange struct {
+	Field   string `json:"field"`
+	Removed string `json:"removed"`
+	Added   string `json:"added"`
+}
+
+// ListChange is a change of a field holding a list, such as cc or
+// keywords, with the items that were removed and added
+type ListChange struct {
+	Field   string   `json:"field"`
+	Removed []string `json:"removed"`
+	Added   []string `json:"added"`
+}
+
+// FlagChange is a flag that was set, changed or cleared. Removed and
+// Added are formatted with FormatFlag() and empty when the flag was set
+// or cleared, respectively.
+type FlagChange struct {
+	Name    string `json:"name"`
+	Removed string `json:"removed"`
+	Added   string `json:"added"`
+	Flag    *Flag  `json:"flag"`
+}
+
+// BugDiff has the differences between two snapshots of a bug
+type BugDiff struct {
+	BugID                int           `json:"bug_id"`
+	Fields               []FieldChange `json:"fields"`
+	Lists                []ListChange  `json:"lists"`
+	Flags                []FlagChange  `json:"flags"`
+	NewComments          []*Comment    `json:"new_comments"`
+	NewAttachments       []*Attachment `json:"new_attachments"`
+	ObsoletedAttachments []*Attachment `json:"obsoleted_attachments"`
+
+	bug *Bug
+}
+
+// bugList reads a field of a Bug holding a list
+type bugList struct {
+	name  string
+	items func(bug *Bug) []string
+}
+
+func splitKeywords(keywords string) []string {
+	var items []string
+	for _, keyword := range strings.Split(keywords, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			items = append(items, keyword)
+		}
+	}
+	return items
+}
+
+func intStrings(values []int) []string {
+	var items []string
+	for _, value := range values {
+		items = append(items, strconv.Itoa(value))
+	}
+	return items
+}
+
+var bugLists = []bugList{
+	{"alias", func(b *Bug) []string { return b.Alias }},
+	{"cc", func(b *Bug) []string { return b.Cc }},
+	{"keywords", func(b *Bug) []string { return splitKeywords(b.Keywords) }},
+	{"groups", func(b *Bug) []string {
+		var names []string
+		for _, group := range b.Groups {
+			names = append(names, group.Name)
+		}
+		return names
+	}},
+	{"dependson", func(b *Bug) []string { return intStrings(b.DependsOn) }},
+	{"blocked", func(b *Bug) []string { return intStrings(b.Blocks) }},
+}
+
+// missing lists the items of a that are not in b, keeping their order
+func missing(a, b []string) []string {
+	found := make(map[string]bool)
+	for _, item := range b {
+		found[item] = true
+	}
+	items := []string{}
+	for _, item := range a {
+		if !found[item] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Diff compares two snapshots of the same bug, as one from the Cacher and
+// one just fetched with GetBug()
+func Diff(old, bug *Bug) *BugDiff {
+	return diffBugs(old, bug, lastCommentID(old))
+}
+
+// diffBugs works as Diff(), but only compares comments by ID, so that old
+// can have them stripped: the ones after lastComment are new
+func diffBugs(old, bug *Bug, lastComment int) *BugDiff {
+	diff := &BugDiff{BugID: bug.BugID, bug: bug,
+		Fields: []FieldChange{}, Lists: []ListChange{}, Flags: []FlagChange{},
+		NewComments: []*Comment{}, NewAttachments: []*Attachment{},
+		ObsoletedAttachments: []*Attachment{}}
+
+	for _, fields := range [][]bugField{statusFields, bugFields} {
+		for _, field := range fields {
+			removed, added := field.value(old), field.value(bug)
+			if removed != added {
+				diff.Fields = append(diff.Fields, FieldChange{field.name, removed, added})
+			}
+		}
+	}
+
+	for _, list := range bugLists {
+		before, after := list.items(old), list.items(bug)
+		change := ListChange{list.name, missing(before, after), missing(after, before)}
+		if len(change.Removed) > 0 || len(change.Added) > 0 {
+			diff.Lists = append(diff.Lists, change)
+		}
+	}
+
+	oldFlags := make(map[int]*Flag)
+	for i := range old.Flags {
+		oldFlags[old.Flags[i].ID] = &old.Flags[i]
+	}
+	for i := range bug.Flags {
+		flag := &bug.Flags[i]
+		previous, ok := oldFlags[flag.ID]
+		delete(oldFlags, flag.ID)
+		if ok && FormatFlag(previous) == FormatFlag(flag) {
+			continue
+		}
+		change := FlagChange{Name: flag.Name, Added: FormatFlag(flag), Flag: flag}
+		if ok {
+			change.Removed = FormatFlag(previous)
+		}
+		diff.Flags = append(diff.Flags, change)
+	}
+	for i := range old.Flags {
+		flag := &old.Flags[i]
+		if _, cleared := oldFlags[flag.ID]; cleared {
+			diff.Flags = append(diff.Flags, FlagChange{Name: flag.Name, Removed: FormatFlag(flag), Flag: flag})
+		}
+	}
+
+	oldAttachments := make(map[int]*Attachment)
+	for _, attachment := range old.Attachments {
+		oldAttachments[attachment.AttachID] = attachment
+	}
+	for _, attachment := range bug.Attachments {
+		previous, ok := oldAttachments[attachment.AttachID]
+		switch {
+		case !ok:
+			diff.NewAttachments = append(diff.NewAttachments, attachment)
+		case previous.IsObsolete == 0 && attachment.IsObsolete != 0:
+			diff.ObsoletedAttachments = append(diff.ObsoletedAttachments, attachment)
+		}
+	}
+
+	for _, comment := range bug.Comments {
+		if comment.ID > lastComment {
+			diff.NewComments = append(diff.NewComments, comment)
+		}
+	}
+	return diff
+}
+
+// Empty tells whether nothing changed
+func (d *BugDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Lists) == 0 && len(d.Flags) == 0 &&
+		len(d.NewComments) == 0 && len(d.NewAttachments) == 0 &&
+		len(d.ObsoletedAttachments) == 0
+}
+
+// Events turns the differences into Events, as sent by the Watcher
+func (d *BugDiff) Events() []Event {
+	var events []Event
+	event := func(kind EventKind) Event {
+		e := Event{Kind: kind, BugID: d.BugID}
+		if d.bug != nil {
+			e.When = d.bug.DeltaTS
+		}
+		return e
+	}
+	for _, change := range d.Fields {
+		e := event(EventField)
+		if change.Field == "bug_status" || change.Field == "resolution" {
+			e.Kind = EventStatus
+		}
+		e.Field, e.Removed, e.Added = change.Field, change.Removed, change.Added
+		events = append(events, e)
+	}
+	for _, change := range d.Lists {
+		e := event(EventField)
+		e.Field = change.Field
+		e.Removed = strings.Join(change.Removed, ", ")
+		e.Added = strings.Join(change.Added, ", ")
+		events = append(events, e)
+	}
+	for _, change := range d.Flags {
+		e := event(EventFlag)
+		e.Field, e.Removed, e.Added, e.Flag = change.Name, change.Removed, change.Added, change.Flag
+		if change.Added != "" {
+			e.Who = change.Flag.Setter
+		}
+		events = append(events, e)
+	}
+	for _, attachment := range d.NewAttachments {
+		e := event(EventAttachment)
+		e.When, e.Who, e.Attachment = attachment.Date, attachment.Attacher.Email, attachment
+		events = append(events, e)
+	}
+	for _, attachment := range d.ObsoletedAttachments {
+		e := event(EventAttachment)
+		e.Attachment = attachment
+		e.Field, e.Removed, e.Added = "isobsolete", "0", "1"
+		events = append(events, e)
+	}
+	for _, comment := range d.NewComments {
+		e := event(EventComment)
+		e.When, e.Who, e.Comment = comment.BugWhen, comment.Who.Email, comment
+		events = append(events, e)
+	}
+	return events
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+// WriteText writes the differences in a human readable form, one change
+// per line
+func (d *BugDiff) WriteText(w io.Writer) error {
+	var lines []string
+	for _, change := range d.Fields {
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", change.Field, orNone(change.Removed), orNone(change.Added)))
+	}
+	for _, change := range d.Lists {
+		var parts []string
+		if len(change.Removed) > 0 {
+			parts = append(parts, "removed "+strings.Join(change.Removed, ", "))
+		}
+		if len(change.Added) > 0 {
+			parts = append(parts, "added "+strings.Join(change.Added, ", "))
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", change.Field, strings.Join(parts, "; ")))
+	}
+	for _, change := range d.Flags {
+		lines = append(lines, fmt.Sprintf("flag %s: %s -> %s", change.Name, orNone(change.Removed), orNone(change.Added)))
+	}
+	for _, attachment := range d.NewAttachments {
+		lines = append(lines, fmt.Sprintf("new attachment %d by %s: %s", attachment.AttachID, attachment.Attacher.Email, attachment.Desc))
+	}
+	for _, attachment := range d.ObsoletedAttachments {
+		lines = append(lines, fmt.Sprintf("obsoleted attachment %d: %s", attachment.AttachID, attachment.Desc))
+	}
+	for _, comment := range d.NewComments {
+		lines = append(lines, fmt.Sprintf("new comment #%d by %s", comment.Count, comment.Who.Email))
+	}
+
+	_, err := fmt.Fprintf(w, "Bug %d\n", d.BugID)
+	for _, line := range lines {
+		if err != nil {
+			break
+		}
+		_, err = fmt.Fprintf(w, "  %s\n", line)
+	}
+	return err
+}
+
+func (d *BugDiff) String() string {
+	var text strings.Builder
+	d.WriteText(&text)
+	return text.String()
+}
+
+// WriteJSON writes the differences as JSON
+func (d *BugDiff) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,107 @@
+package bugzilla_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+func diffBugs() (*bugzilla.Bug, *bugzilla.Bug) {
+	old := &bugzilla.Bug{
+		BugID:     1047068,
+		BugStatus: "NEW",
+		Priority:  "P5 - None",
+		Keywords:  "DSLA_REQUIRED, DSLA_SOLUTION_PROVIDED",
+		Cc:        []string{"user@foobar.com", "other@foobar.com"},
+		Groups:    []bugzilla.Group{{ID: 1, Name: "suse"}},
+		DependsOn: []int{10},
+		Flags:     []bugzilla.Flag{{Name: "needinfo", ID: 700, Status: "?", Requestee: "user@foobar.com"}},
+		Comments:  []*bugzilla.Comment{{ID: 1, Count: 0}},
+		Attachments: []*bugzilla.Attachment{
+			{AttachID: 100, Desc: "first patch"},
+			{AttachID: 101, Desc: "old log", IsObsolete: 1},
+		},
+	}
+	bug := *old
+	bug.BugStatus = "RESOLVED"
+	bug.Resolution = "FIXED"
+	bug.Keywords = "DSLA_SOLUTION_PROVIDED"
+	bug.Cc = []string{"other@foobar.com", "new@foobar.com"}
+	bug.Groups = []bugzilla.Group{{ID: 1, Name: "suse"}, {ID: 2, Name: "partners"}}
+	bug.Flags = []bugzilla.Flag{{Name: "SHIP_STOPPER", ID: 701, Status: "+", Setter: "user@foobar.com"}}
+	bug.Comments = []*bugzilla.Comment{{ID: 1, Count: 0},
+		{ID: 5, Count: 1, Who: bugzilla.User{Email: "user@foobar.com"}}}
+	bug.Attachments = []*bugzilla.Attachment{
+		{AttachID: 100, Desc: "first patch", IsObsolete: 1},
+		{AttachID: 101, Desc: "old log", IsObsolete: 1},
+		{AttachID: 102, Desc: "second patch", Attacher: bugzilla.User{Email: "user@foobar.com"}},
+	}
+	return old, &bug
+}
+
+func (cs *clientSuite) TestDiff(c *C) {
+	old, bug := diffBugs()
+	diff := bugzilla.Diff(old, bug)
+
+	c.Assert(diff.BugID, Equals, 1047068)
+	c.Assert(diff.Fields, DeepEquals, []bugzilla.FieldChange{
+		{Field: "bug_status", Removed: "NEW", Added: "RESOLVED"},
+		{Field: "resolution", Removed: "", Added: "FIXED"},
+	})
+	c.Assert(diff.Lists, DeepEquals, []bugzilla.ListChange{
+		{Field: "cc", Removed: []string{"user@foobar.com"}, Added: []string{"new@foobar.com"}},
+		{Field: "keywords", Removed: []string{"DSLA_REQUIRED"}, Added: []string{}},
+		{Field: "groups", Removed: []string{}, Added: []string{"partners"}},
+	})
+	c.Assert(diff.Flags, HasLen, 2)
+	c.Assert(diff.Flags[0].Name, Equals, "SHIP_STOPPER")
+	c.Assert(diff.Flags[0].Removed, Equals, "")
+	c.Assert(diff.Flags[0].Added, Equals, "SHIP_STOPPER+")
+	c.Assert(diff.Flags[1].Removed, Equals, "needinfo?(user@foobar.com)")
+	c.Assert(diff.Flags[1].Added, Equals, "")
+	c.Assert(diff.NewComments, HasLen, 1)
+	c.Assert(diff.NewComments[0].ID, Equals, 5)
+	c.Assert(diff.NewAttachments, HasLen, 1)
+	c.Assert(diff.NewAttachments[0].AttachID, Equals, 102)
+	c.Assert(diff.ObsoletedAttachments, HasLen, 1)
+	c.Assert(diff.ObsoletedAttachments[0].AttachID, Equals, 100)
+	c.Assert(diff.Empty(), Equals, false)
+
+	c.Assert(bugzilla.Diff(old, old).Empty(), Equals, true)
+}
+
+func (cs *clientSuite) TestDiffText(c *C) {
+	old, bug := diffBugs()
+	c.Assert(bugzilla.Diff(old, bug).String(), Equals, `Bug 1047068
+  bug_status: NEW -> RESOLVED
+  resolution: (none) -> FIXED
+  cc: removed user@foobar.com; added new@foobar.com
+  keywords: removed DSLA_REQUIRED
+  groups: added partners
+  flag SHIP_STOPPER: (none) -> SHIP_STOPPER+
+  flag needinfo: needinfo?(user@foobar.com) -> (none)
+  new attachment 102 by user@foobar.com: second patch
+  obsoleted attachment 100: first patch
+  new comment #1 by user@foobar.com
+`)
+}
+
+func (cs *clientSuite) TestDiffJSON(c *C) {
+	old, bug := diffBugs()
+	var buf bytes.Buffer
+	c.Assert(bugzilla.Diff(old, bug).WriteJSON(&buf), IsNil)
+
+	var decoded bugzilla.BugDiff
+	c.Assert(json.Unmarshal(buf.Bytes(), &decoded), IsNil)
+	c.Assert(decoded.BugID, Equals, 1047068)
+	c.Assert(decoded.Fields, HasLen, 2)
+	c.Assert(decoded.Lists[0].Added, DeepEquals, []string{"new@foobar.com"})
+	c.Assert(decoded.ObsoletedAttachments[0].AttachID, Equals, 100)
+
+	// nothing changed still has all the lists, empty
+	buf.Reset()
+	c.Assert(bugzilla.Diff(old, old).WriteJSON(&buf), IsNil)
+	c.Assert(buf.String(), Matches, `(?s).*"new_comments":\[\].*`)
+}
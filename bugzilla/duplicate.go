@@ -0,0 +1,124 @@
+package bugzilla
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResolutionDuplicate is the resolution used for duplicated bugs
+const ResolutionDuplicate = "DUPLICATE"
+
+// maxDuplicateChain limits how many duplicates are followed to find the
+// canonical bug
+const maxDuplicateChain = 20
+
+// DuplicateOptions tunes MarkDuplicateWithOptions()
+type DuplicateOptions struct {
+	// CcReporter adds the reporter of the duplicate to the Cc list of the
+	// canonical bug
+	CcReporter bool
+}
+
+// DuplicateResult tells which bug was used as the canonical one and has
+// the warnings found while checking both bugs
+type DuplicateResult struct {
+	Canonical int
+	Chain     []int
+	Warnings  []string
+}
+
+// findCanonical follows the chain of duplicates starting at of, failing if
+// it reaches id or loops
+func (c *Client) findCanonical(id, of int) (*Bug, []int, error) {
+	chain := []int{of}
+	seen := map[int]bool{id: true}
+	current := of
+	for {
+		if current == id {
+			return nil, chain, RequestError{fmt.Errorf("bug %d can't be a duplicate of itself (chain: %v)", id, chain)}
+		}
+		if seen[current] {
+			return nil, chain, RequestError{fmt.Errorf("duplicate cycle found: %v", chain)}
+		}
+		seen[current] = true
+
+		bug, err := c.GetBug(current)
+		if err != nil {
+			return nil, chain, err
+		}
+		if bug.Resolution != ResolutionDuplicate || bug.DupID == 0 {
+			return bug, chain, nil
+		}
+		if len(chain) > maxDuplicateChain {
+			return nil, chain, RequestError{fmt.Errorf("duplicate chain too long: %v", chain)}
+		}
+		current = bug.DupID
+		chain = append(chain, current)
+	}
+}
+
+// restrictedGroups lists the groups of target that bug is not in
+func restrictedGroups(bug, target *Bug) (groups []string) {
+	names := make(map[string]bool)
+	for _, group := range bug.Groups {
+		names[group.Name] = true
+	}
+	for _, group := range target.Groups {
+		if !names[group.Name] {
+			groups = append(groups, group.Name)
+		}
+	}
+	return
+}
+
+// MarkDuplicate resolves the bug id as a duplicate of the bug of. When of
+// is itself a duplicate, the chain is followed up to the canonical bug.
+func (c *Client) MarkDuplicate(id, of int, comment string) (*DuplicateResult, error) {
+	return c.MarkDuplicateWithOptions(id, of, comment, DuplicateOptions{})
+}
+
+// MarkDuplicateWithOptions works as MarkDuplicate() with the options set
+// in DuplicateOptions
+func (c *Client) MarkDuplicateWithOptions(id, of int, comment string, options DuplicateOptions) (*DuplicateResult, error) {
+	if id == of {
+		return nil, RequestError{fmt.Errorf("bug %d can't be a duplicate of itself", id)}
+	}
+
+	canonical, chain, err := c.findCanonical(id, of)
+	if err != nil {
+		return nil, err
+	}
+	bug, err := c.GetBug(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DuplicateResult{Canonical: canonical.BugID, Chain: chain}
+	if groups := restrictedGroups(bug, canonical); len(groups) > 0 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("bug %d is restricted to groups bug %d is not in: %s",
+				canonical.BugID, id, strings.Join(groups, ", ")))
+	}
+
+	changes := Changes{
+		SetResolution: ResolutionDuplicate,
+		SetDuplicate:  canonical.BugID,
+		AddComment:    comment,
+	}
+	if bug.Resolution == "" {
+		changes.SetStatus = StatusResolved
+	}
+	_, err = c.Update(id, changes)
+	if err != nil {
+		return result, err
+	}
+
+	reporter := bug.Reporter.Email
+	if options.CcReporter && reporter != "" && reporter != canonical.Reporter.Email && !contains(canonical.Cc, reporter) {
+		_, err = c.Update(canonical.BugID, Changes{AddCc: reporter})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package bugzilla_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+type fakeBug struct {
+	resolution string
+	dupID      int
+	reporter   string
+	partner    bool
+}
+
+type duplicateServer struct {
+	bugs    map[int]fakeBug
+	updated []int
+	queries []url.Values
+}
+
+func (ds *duplicateServer) bugXML(id int) string {
+	bug := ds.bugs[id]
+	xml := strings.Replace(bugXml, "<bug_id>1047068</bug_id>", fmt.Sprintf("<bug_id>%d</bug_id>", id), 1)
+	xml = strings.Replace(xml, "<resolution>FIXED</resolution>",
+		fmt.Sprintf("<resolution>%s</resolution><dup_id>%d</dup_id>", bug.resolution, bug.dupID), 1)
+	xml = strings.Replace(xml, `<reporter name="Firstname Lastname">username@foobar.com</reporter>`,
+		fmt.Sprintf(`<reporter name="Reporter">%s</reporter>`, bug.reporter), 1)
+	if !bug.partner {
+		xml = strings.Replace(xml, `<group id="17">foobar Enterprise Partner</group>`, "", 1)
+	}
+	return xml
+}
+
+func (ds *duplicateServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/show_bug.cgi":
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		if _, ok := ds.bugs[id]; !ok {
+			http.Error(w, "Not found", 404)
+			return
+		}
+		if r.URL.Query().Get("ctype") == "xml" {
+			io.WriteString(w, ds.bugXML(id))
+			return
+		}
+		ds.updated = append(ds.updated, id)
+		io.WriteString(w, showBugHtml)
+	case "/process_bug.cgi":
+		r.ParseForm()
+		ds.queries = append(ds.queries, r.Form)
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestMarkDuplicateFollowsChain(c *C) {
+	ds := &duplicateServer{bugs: map[int]fakeBug{
+		1: {reporter: "reporter1@foobar.com"},
+		2: {resolution: "DUPLICATE", dupID: 3, reporter: "reporter2@foobar.com"},
+		3: {resolution: "DUPLICATE", dupID: 4, reporter: "reporter3@foobar.com"},
+		4: {reporter: "reporter4@foobar.com", partner: true},
+	}}
+	ts0 := httptest.NewServer(http.HandlerFunc(ds.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	result, err := bz.MarkDuplicateWithOptions(1, 2, "same crash", bugzilla.DuplicateOptions{CcReporter: true})
+	c.Assert(err, IsNil)
+	c.Check(result.Canonical, Equals, 4)
+	c.Check(result.Chain, DeepEquals, []int{2, 3, 4})
+	c.Assert(result.Warnings, HasLen, 1)
+	c.Check(result.Warnings[0], Matches, "bug 4 is restricted to groups bug 1 is not in: foobar Enterprise Partner")
+
+	c.Assert(ds.updated, DeepEquals, []int{1, 4})
+	c.Check(ds.queries[0].Get("bug_status"), Equals, "RESOLVED")
+	c.Check(ds.queries[0].Get("resolution"), Equals, "DUPLICATE")
+	c.Check(ds.queries[0].Get("dup_id"), Equals, "4")
+	c.Check(ds.queries[0].Get("comment"), Equals, "same crash")
+	c.Check(ds.queries[1].Get("newcc"), Equals, "reporter1@foobar.com")
+}
+
+func (cs *clientSuite) TestMarkDuplicateRefusesCycles(c *C) {
+	ds := &duplicateServer{bugs: map[int]fakeBug{
+		1: {},
+		2: {resolution: "DUPLICATE", dupID: 3},
+		3: {resolution: "DUPLICATE", dupID: 2},
+		4: {resolution: "DUPLICATE", dupID: 1},
+	}}
+	ts0 := httptest.NewServer(http.HandlerFunc(ds.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.MarkDuplicate(1, 1, "")
+	c.Check(err, ErrorMatches, ".*can't be a duplicate of itself.*")
+	_, err = bz.MarkDuplicate(1, 4, "")
+	c.Check(err, ErrorMatches, `.*can't be a duplicate of itself \(chain: \[4 1\]\).*`)
+	_, err = bz.MarkDuplicate(1, 2, "")
+	c.Check(err, ErrorMatches, `.*duplicate cycle found: \[2 3 2\].*`)
+	_, err = bz.MarkDuplicate(1, 5, "")
+	c.Check(err, ErrorMatches, ".*Not Found.*")
+	c.Check(ds.updated, HasLen, 0)
+}
@@ -0,0 +1,266 @@
+package bugzilla
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBaseURL is used by ConfigFromEnvironment() when BUGZILLA_URL is
+// not set. This endpoint accepts HTTP Basic auth.
+const DefaultBaseURL = "https://apibugzilla.suse.com"
+
+// Environment variables read by ConfigFromEnvironment()
+const (
+	EnvURL      = "BUGZILLA_URL"
+	EnvUser     = "BUGZILLA_USER"
+	EnvPassword = "BUGZILLA_PASSWORD"
+	EnvAPIKey   = "BUGZILLA_API_KEY"
+)
+
+type credentials struct {
+	user     string
+	password string
+}
+
+// ConfigFromEnvironment builds a Config from the credentials the user
+// already has around. The URL comes from BUGZILLA_URL or DefaultBaseURL.
+// The user and password are looked up in this order:
+//
+//  1. BUGZILLA_USER, BUGZILLA_PASSWORD (and BUGZILLA_API_KEY)
+//  2. ~/.netrc (or $NETRC), in the entry for the Bugzilla host
+//  3. the osc configuration ($OSC_CONFIG, ~/.config/osc/oscrc or
+//     ~/.oscrc), in the section for the Bugzilla URL or else in the
+//     section of the default apiurl. A section named exactly as the URL
+//     is preferred over the ones that only differ in trailing slashes,
+//     and among those the first one in the file is used.
+//
+// Each value is taken from the first source that has it, but a password
+// is only taken from a source that agrees on the user.
+func ConfigFromEnvironment() (Config, error) {
+	config := Config{
+		BaseURL:  os.Getenv(EnvURL),
+		User:     os.Getenv(EnvUser),
+		Password: os.Getenv(EnvPassword),
+		APIKey:   os.Getenv(EnvAPIKey),
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+
+	base, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return config, RequestError{fmt.Errorf("invalid %s: %v", EnvURL, err)}
+	}
+
+	lookups := []func() (credentials, error){
+		func() (credentials, error) { return netrcCredentials(base.Hostname()) },
+		func() (credentials, error) { return oscCredentials(config.BaseURL) },
+	}
+	for _, lookup := range lookups {
+		if config.Password != "" {
+			break
+		}
+		found, err := lookup()
+		if err != nil {
+			return config, err
+		}
+		if config.User == "" {
+			config.User = found.user
+		}
+		if found.user == config.User {
+			config.Password = found.password
+		}
+	}
+
+	if config.Password == "" && config.APIKey == "" {
+		return config, RequestError{fmt.Errorf("no Bugzilla credentials found in the environment, netrc or oscrc")}
+	}
+	return config, nil
+}
+
+func homeFile(env string, candidates ...string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, candidate := range candidates {
+		path := filepath.Join(home, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readOptional reads path, returning nil when it doesn't exist
+func readOptional(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// netrcCredentials finds the login and password for host in the netrc
+// file, falling back to the "default" entry
+func netrcCredentials(host string) (credentials, error) {
+	data, err := readOptional(homeFile("NETRC", ".netrc"))
+	if err != nil || data == nil {
+		return credentials{}, err
+	}
+	return parseNetrc(data, host), nil
+}
+
+func parseNetrc(data []byte, host string) credentials {
+	var found, fallback credentials
+	var current *credentials
+	matched := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case "machine":
+			current = nil
+			if scanner.Scan() && scanner.Text() == host && !matched {
+				current = &found
+				matched = true
+			}
+		case "default":
+			current = &fallback
+		case "login":
+			if scanner.Scan() && current != nil {
+				current.user = scanner.Text()
+			}
+		case "password":
+			if scanner.Scan() && current != nil {
+				current.password = scanner.Text()
+			}
+		case "account", "macdef":
+			// macros would need line based parsing; they are not
+			// expected in files used for credentials
+			scanner.Scan()
+		}
+	}
+	if matched {
+		return found
+	}
+	return fallback
+}
+
+// iniFile has the values of the sections of an INI file, and the names of
+// the sections in the order of the file
+type iniFile struct {
+	sections map[string]map[string]string
+	names    []string
+}
+
+func parseINI(data []byte) *iniFile {
+	ini := &iniFile{sections: make(map[string]map[string]string)}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			continue
+		}
+		if ini.sections[section] == nil {
+			ini.sections[section] = make(map[string]string)
+			ini.names = append(ini.names, section)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:sep]))
+		ini.sections[section][key] = strings.TrimSpace(line[sep+1:])
+	}
+	return ini
+}
+
+// urlSection finds the section of url: the one named exactly as it, or
+// else the first one in the file differing only in trailing slashes
+func (ini *iniFile) urlSection(url string) map[string]string {
+	if section, ok := ini.sections[url]; ok {
+		return section
+	}
+	for _, name := range ini.names {
+		if sameURL(name, url) {
+			return ini.sections[name]
+		}
+	}
+	return nil
+}
+
+// deobfuscate decodes the passwords osc stores as base64 encoded bzip2
+func deobfuscate(value string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	password, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+func oscPassword(section map[string]string) (string, error) {
+	if passx, ok := section["passx"]; ok {
+		return deobfuscate(passx)
+	}
+	manager := section["credentials_mgr_class"]
+	switch {
+	case manager == "" || strings.HasSuffix(manager, ".PlaintextConfigFileCredentialsManager"):
+		return section["pass"], nil
+	case strings.HasSuffix(manager, ".ObfuscatedConfigFileCredentialsManager"):
+		return deobfuscate(section["pass"])
+	}
+	// keyrings and transient managers don't keep the password in the file
+	return "", nil
+}
+
+func sameURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// oscCredentials reads the credentials from the osc configuration
+func oscCredentials(baseURL string) (credentials, error) {
+	data, err := readOptional(homeFile("OSC_CONFIG", filepath.Join(".config", "osc", "oscrc"), ".oscrc"))
+	if err != nil || data == nil {
+		return credentials{}, err
+	}
+	ini := parseINI(data)
+
+	section := ini.urlSection(baseURL)
+	if apiurl := ini.sections["general"]["apiurl"]; section == nil && apiurl != "" {
+		section = ini.urlSection(apiurl)
+	}
+	if section == nil {
+		return credentials{}, nil
+	}
+
+	password, err := oscPassword(section)
+	if err != nil {
+		return credentials{}, RequestError{fmt.Errorf("failed to decode the password from the osc configuration: %v", err)}
+	}
+	return credentials{user: section["user"], password: password}, nil
+}
@@ -0,0 +1,170 @@
+package bugzilla_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+// "oscsecret" compressed with bzip2 and encoded with base64
+const obfuscatedPassword = "QlpoOTFBWSZTWRLCFFgAAAIBgAoAnAAgADDACGmykMEY+LuSKcKEgJYQosA="
+
+const sampleOscrc = `[general]
+apiurl = https://api.suse.de
+
+[https://api.opensuse.org]
+user = other
+pass = nope
+
+[https://api.suse.de]
+user = oscuser
+passx = ` + obfuscatedPassword + `
+`
+
+const sampleNetrc = `machine example.com login someone password wrong
+machine apibugzilla.suse.com
+	login netrcuser
+	password netrcsecret
+`
+
+// setEnvironment points the environment to files in a temporary directory,
+// returning a function that restores it
+func setEnvironment(c *C, vars map[string]string, files map[string]string) func() {
+	dir := c.MkDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+		if name == "oscrc" {
+			vars["OSC_CONFIG"] = path
+		} else {
+			vars["NETRC"] = path
+		}
+	}
+	all := []string{"HOME", "OSC_CONFIG", "NETRC", bugzilla.EnvURL,
+		bugzilla.EnvUser, bugzilla.EnvPassword, bugzilla.EnvAPIKey}
+	saved := make(map[string]string)
+	for _, name := range all {
+		saved[name] = os.Getenv(name)
+		os.Unsetenv(name)
+	}
+	os.Setenv("HOME", dir)
+	for name, value := range vars {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+func (cs *clientSuite) TestConfigFromEnvironmentVariables(c *C) {
+	defer setEnvironment(c, map[string]string{
+		bugzilla.EnvURL:      "https://bugzilla.example.com",
+		bugzilla.EnvUser:     "envuser",
+		bugzilla.EnvPassword: "envsecret",
+	}, map[string]string{"oscrc": sampleOscrc, "netrc": sampleNetrc})()
+
+	config, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, IsNil)
+	c.Check(config.BaseURL, Equals, "https://bugzilla.example.com")
+	c.Check(config.User, Equals, "envuser")
+	c.Check(config.Password, Equals, "envsecret")
+}
+
+func (cs *clientSuite) TestConfigFromNetrc(c *C) {
+	defer setEnvironment(c, map[string]string{},
+		map[string]string{"oscrc": sampleOscrc, "netrc": sampleNetrc})()
+
+	config, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, IsNil)
+	c.Check(config.BaseURL, Equals, bugzilla.DefaultBaseURL)
+	c.Check(config.User, Equals, "netrcuser")
+	c.Check(config.Password, Equals, "netrcsecret")
+}
+
+func (cs *clientSuite) TestConfigFromOscrc(c *C) {
+	defer setEnvironment(c, map[string]string{},
+		map[string]string{"oscrc": sampleOscrc})()
+
+	config, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, IsNil)
+	c.Check(config.User, Equals, "oscuser")
+	c.Check(config.Password, Equals, "oscsecret")
+}
+
+func (cs *clientSuite) TestConfigFromOscrcObfuscatedManager(c *C) {
+	oscrc := `[general]
+apiurl = https://api.suse.de/
+
+[https://api.suse.de]
+user = oscuser
+pass = ` + obfuscatedPassword + `
+credentials_mgr_class = osc.credentials.ObfuscatedConfigFileCredentialsManager
+`
+	defer setEnvironment(c, map[string]string{}, map[string]string{"oscrc": oscrc})()
+
+	config, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, IsNil)
+	c.Check(config.User, Equals, "oscuser")
+	c.Check(config.Password, Equals, "oscsecret")
+}
+
+func (cs *clientSuite) TestConfigFromOscrcSectionPrecedence(c *C) {
+	oscrc := `[general]
+apiurl = https://api.suse.de
+
+[https://api.suse.de//]
+user = slashes
+pass = wrong
+
+[https://api.suse.de/]
+user = slash
+pass = wrong
+
+[https://api.suse.de]
+user = exact
+pass = right
+`
+	// the section named as apiurl wins over the ones with slashes
+	for i := 0; i < 10; i++ {
+		restore := setEnvironment(c, map[string]string{}, map[string]string{"oscrc": oscrc})
+		config, err := bugzilla.ConfigFromEnvironment()
+		restore()
+		c.Assert(err, IsNil)
+		c.Check(config.User, Equals, "exact")
+		c.Check(config.Password, Equals, "right")
+	}
+
+	// otherwise the first one in the file
+	oscrc = strings.Replace(oscrc, "[https://api.suse.de]", "[https://api.suse.de///]", 1)
+	for i := 0; i < 10; i++ {
+		restore := setEnvironment(c, map[string]string{}, map[string]string{"oscrc": oscrc})
+		config, err := bugzilla.ConfigFromEnvironment()
+		restore()
+		c.Assert(err, IsNil)
+		c.Check(config.User, Equals, "slashes")
+	}
+}
+
+func (cs *clientSuite) TestConfigFromEnvironmentUserMismatch(c *C) {
+	// the password in netrc belongs to another user, oscrc has the right one
+	defer setEnvironment(c, map[string]string{bugzilla.EnvUser: "oscuser"},
+		map[string]string{"oscrc": sampleOscrc, "netrc": sampleNetrc})()
+
+	config, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, IsNil)
+	c.Check(config.User, Equals, "oscuser")
+	c.Check(config.Password, Equals, "oscsecret")
+}
+
+func (cs *clientSuite) TestConfigFromEnvironmentMissing(c *C) {
+	defer setEnvironment(c, map[string]string{}, nil)()
+
+	_, err := bugzilla.ConfigFromEnvironment()
+	c.Assert(err, FitsTypeOf, bugzilla.RequestError{})
+}
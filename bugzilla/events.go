@@ -0,0 +1,256 @@
+package bugzilla
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventKind tells what changed in a bug
+type EventKind string
+
+// Kinds of Event
+const (
+	EventComment    EventKind = "comment"
+	EventStatus     EventKind = "status"
+	EventFlag       EventKind = "flag"
+	EventAttachment EventKind = "attachment"
+	EventField      EventKind = "field"
+)
+
+// Event is a change to a bug. Status, flag and field changes have the
+// name of the field (or of the flag) in Field and the old and new values
+// in Removed and Added, flags formatted as in "needinfo?(user@foobar.com)";
+// for lists such as cc, only the items removed and added are there, comma
+// separated. Obsoleted attachments have the field "isobsolete".
+// Comment, Attachment and Flag are set for the events of these kinds; Flag
+// is the old flag when it was removed. Who is only known for comments,
+// attachments and flags.
+type Event struct {
+	Kind       EventKind   `json:"kind"`
+	BugID      int         `json:"bug_id"`
+	When       time.Time   `json:"when"`
+	Who        string      `json:"who,omitempty"`
+	Field      string      `json:"field,omitempty"`
+	Removed    string      `json:"removed,omitempty"`
+	Added      string      `json:"added,omitempty"`
+	Comment    *Comment    `json:"comment,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+	Flag       *Flag       `json:"flag,omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventComment:
+		return fmt.Sprintf("bug %d: comment %d by %s", e.BugID, e.Comment.Count, e.Who)
+	case EventAttachment:
+		if e.Field != "" {
+			return fmt.Sprintf("bug %d: attachment %d: %s: %q -> %q", e.BugID, e.Attachment.AttachID, e.Field, e.Removed, e.Added)
+		}
+		return fmt.Sprintf("bug %d: attachment %d (%s) by %s", e.BugID, e.Attachment.AttachID, e.Attachment.Desc, e.Who)
+	}
+	return fmt.Sprintf("bug %d: %s: %q -> %q", e.BugID, e.Field, e.Removed, e.Added)
+}
+
+func joinInts(values []int, sep string) string {
+	var list []string
+	for _, value := range values {
+		list = append(list, strconv.Itoa(value))
+	}
+	return strings.Join(list, sep)
+}
+
+func formatOptionalInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// bugField reads a field of a Bug as text, named as in the Bugzilla forms
+type bugField struct {
+	name  string
+	value func(bug *Bug) string
+}
+
+var statusFields = []bugField{
+	{"bug_status", func(b *Bug) string { return b.BugStatus }},
+	{"resolution", func(b *Bug) string { return b.Resolution }},
+}
+
+var bugFields = []bugField{
+	{"short_desc", func(b *Bug) string { return b.ShortDesc }},
+	{"product", func(b *Bug) string { return b.Product }},
+	{"component", func(b *Bug) string { return b.Component }},
+	{"version", func(b *Bug) string { return b.Version }},
+	{"rep_platform", func(b *Bug) string { return b.RepPlatform }},
+	{"op_sys", func(b *Bug) string { return b.OpSys }},
+	{"priority", func(b *Bug) string { return b.Priority }},
+	{"bug_severity", func(b *Bug) string { return b.BugSeverity }},
+	{"target_milestone", func(b *Bug) string { return b.TargetMilestone }},
+	{"assigned_to", func(b *Bug) string { return b.AssignedTo.Email }},
+	{"qa_contact", func(b *Bug) string { return b.QAContact.Email }},
+	{"status_whiteboard", func(b *Bug) string { return b.StatusWhiteboard }},
+	{"bug_file_loc", func(b *Bug) string { return b.BugFileLoc }},
+	{"dup_id", func(b *Bug) string { return formatOptionalInt(b.DupID) }},
+	{"deadline", func(b *Bug) string { return b.Deadline }},
+	{"estimated_time", func(b *Bug) string { return formatHours(b.EstimatedTime) }},
+	{"remaining_time", func(b *Bug) string { return formatHours(b.RemainingTime) }},
+}
+
+// FormatFlag formats a flag as Bugzilla does in bug mail and activity,
+// as in "needinfo?(user@foobar.com)"
+func FormatFlag(flag *Flag) string {
+	text := flag.Name + flag.Status
+	if flag.Requestee != "" {
+		text += "(" + flag.Requestee + ")"
+	}
+	return text
+}
+
+func lastCommentID(bug *Bug) int {
+	last := 0
+	for _, comment := range bug.Comments {
+		if comment.ID > last {
+			last = comment.ID
+		}
+	}
+	return last
+}
+
+// fieldDescriptions maps the descriptions of the fields, used in bug mail
+// and in the activity of bugs, to the names of the fields in the forms
+var fieldDescriptions = map[string]string{
+	"Status":           "bug_status",
+	"Resolution":       "resolution",
+	"Summary":          "short_desc",
+	"Product":          "product",
+	"Component":        "component",
+	"Version":          "version",
+	"Hardware":         "rep_platform",
+	"OS":               "op_sys",
+	"Priority":         "priority",
+	"Severity":         "bug_severity",
+	"Target Milestone": "target_milestone",
+	"Assignee":         "assigned_to",
+	"QA Contact":       "qa_contact",
+	"Whiteboard":       "status_whiteboard",
+	"Keywords":         "keywords",
+	"URL":              "bug_file_loc",
+	"CC":               "cc",
+	"Alias":            "alias",
+	"Depends on":       "dependson",
+	"Blocks":           "blocked",
+	"Group":            "groups",
+	"Deadline":         "deadline",
+	"Orig. Est.":       "estimated_time",
+	"Hours Left":       "remaining_time",
+	"Flags":            "flagtypes.name",
+}
+
+// listFields are the fields whose changes are reported as comma separated
+// lists of the items removed and added
+var listFields = map[string]bool{
+	"alias": true, "cc": true, "keywords": true, "dependson": true, "blocked": true,
+	"groups": true, "flagtypes.name": true,
+}
+
+var (
+	flagRe            = regexp.MustCompile(`^(.+?)([?+-])(?:\((.*)\))?$`)
+	attachmentFieldRe = regexp.MustCompile(`^Attachment #(\d+) (.*)$`)
+)
+
+func normalizeList(value string) string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// changeEvents turns a change of field, named as in the forms and reported
+// by Bugzilla in bug mail or webhooks, into events like base: one for each
+// flag for the flags, and an attachment event when attachment is marked
+// as obsolete
+func changeEvents(base Event, field, removed, added string, attachment *Attachment) []Event {
+	if listFields[field] {
+		removed, added = normalizeList(removed), normalizeList(added)
+	}
+	if field == "resolution" {
+		removed, added = strings.TrimPrefix(removed, "---"), strings.TrimPrefix(added, "---")
+	}
+
+	e := base
+	e.Field, e.Removed, e.Added, e.Attachment = field, removed, added, attachment
+	switch {
+	case field == "flagtypes.name":
+		return flagEvents(base, removed, added, attachment)
+	case field == "isobsolete" && attachment != nil:
+		e.Kind = EventAttachment
+	case field == "bug_status" || field == "resolution":
+		e.Kind = EventStatus
+	default:
+		e.Kind = EventField
+	}
+	return []Event{e}
+}
+
+// parseFlag reads a flag formatted by FormatFlag()
+func parseFlag(text string) (*Flag, bool) {
+	match := flagRe.FindStringSubmatch(text)
+	if match == nil {
+		return nil, false
+	}
+	return &Flag{Name: match[1], Status: match[2], Requestee: match[3]}, true
+}
+
+// flagEvents pairs the flags removed and added by name. The flags added
+// are taken as set by base.Who.
+func flagEvents(base Event, removed, added string, attachment *Attachment) []Event {
+	var names []string
+	flags := make(map[string]*Event)
+	collect := func(list string, isAdded bool) {
+		for _, text := range strings.Split(list, ", ") {
+			flag, ok := parseFlag(text)
+			if !ok {
+				continue
+			}
+			e, seen := flags[flag.Name]
+			if !seen {
+				event := base
+				event.Kind, event.Field, event.Attachment = EventFlag, flag.Name, attachment
+				e = &event
+				flags[flag.Name] = e
+				names = append(names, flag.Name)
+			}
+			if isAdded {
+				flag.Setter = base.Who
+				e.Added, e.Flag = text, flag
+			} else {
+				e.Removed = text
+				if e.Flag == nil {
+					e.Flag = flag
+				}
+			}
+		}
+	}
+	collect(removed, false)
+	collect(added, true)
+
+	var events []Event
+	for _, name := range names {
+		events = append(events, *flags[name])
+	}
+	return events
+}
+
+// bugEvents lists the changes from old to bug. Comments are only compared
+// by ID, so that old can have them stripped: the ones after lastComment
+// are new.
+func bugEvents(old, bug *Bug, lastComment int) []Event {
+	return diffBugs(old, bug, lastComment).Events()
+}
@@ -0,0 +1,227 @@
+package bugzilla
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// page is an HTML page fetched for a single operation, so that nothing of
+// it is kept in the Client
+type page struct {
+	url *url.URL
+	doc *goquery.Document
+}
+
+func parsePage(rawURL string, body []byte) (*page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, RequestError{err}
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, ConnectionError{fmt.Errorf("failed to parse the HTML page: %v", err)}
+	}
+	return &page{url: u, doc: doc}, nil
+}
+
+// htmlForm has the values a browser would submit for a form, which can
+// then be changed before submitting it
+type htmlForm struct {
+	selection  *goquery.Selection
+	action     *url.URL
+	method     string
+	enctype    string
+	values     url.Values
+	checkboxes map[string]string
+}
+
+// form finds the form matching selector in the page and collects the
+// values of its successful controls, following the rules of the HTML
+// specification: disabled controls and buttons are not sent, checkboxes
+// and radio buttons only when checked (checked, checked="" and
+// checked="checked" are all the same), selects send their selected
+// options, or the first option when none is selected and the select is not
+// multiple.
+func (p *page) form(selector string) (*htmlForm, error) {
+	selection := p.doc.Find(selector).First()
+	if selection.Length() == 0 {
+		return nil, fmt.Errorf("no form matching %s found", selector)
+	}
+	action, err := p.url.Parse(selection.AttrOr("action", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form action: %v", err)
+	}
+	form := &htmlForm{
+		selection:  selection,
+		action:     action,
+		method:     strings.ToUpper(selection.AttrOr("method", "GET")),
+		enctype:    strings.ToLower(selection.AttrOr("enctype", "application/x-www-form-urlencoded")),
+		values:     make(url.Values),
+		checkboxes: make(map[string]string),
+	}
+
+	selection.Find("input, textarea, select").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok || name == "" || isDisabled(s) {
+			return
+		}
+		switch goquery.NodeName(s) {
+		case "textarea":
+			form.values.Add(name, s.Text())
+		case "select":
+			form.addSelect(name, s)
+		default:
+			form.addInput(name, s)
+		}
+	})
+	return form, nil
+}
+
+func isDisabled(s *goquery.Selection) bool {
+	if _, disabled := s.Attr("disabled"); disabled {
+		return true
+	}
+	return s.ParentsFiltered("fieldset[disabled]").Length() > 0
+}
+
+func (f *htmlForm) addInput(name string, s *goquery.Selection) {
+	kind := strings.ToLower(s.AttrOr("type", "text"))
+	value := s.AttrOr("value", "")
+	switch kind {
+	case "submit", "button", "reset", "image", "file":
+		return
+	case "checkbox", "radio":
+		if value == "" {
+			value = "on"
+		}
+		if kind == "checkbox" {
+			if _, ok := f.checkboxes[name]; !ok {
+				f.checkboxes[name] = value
+			}
+		}
+		if _, checked := s.Attr("checked"); !checked {
+			return
+		}
+	}
+	f.values.Add(name, value)
+}
+
+func optionValue(s *goquery.Selection) string {
+	if value, ok := s.Attr("value"); ok {
+		return value
+	}
+	return strings.TrimSpace(s.Text())
+}
+
+func (f *htmlForm) addSelect(name string, s *goquery.Selection) {
+	_, multiple := s.Attr("multiple")
+	options := s.Find("option")
+	selected := options.FilterFunction(func(i int, o *goquery.Selection) bool {
+		_, ok := o.Attr("selected")
+		return ok && !isDisabled(o)
+	})
+	if selected.Length() == 0 && !multiple {
+		selected = options.First()
+	}
+	if !multiple {
+		selected = selected.Last()
+	}
+	selected.Each(func(i int, o *goquery.Selection) {
+		f.values.Add(name, optionValue(o))
+	})
+}
+
+// Value returns the first value of the field name
+func (f *htmlForm) Value(name string) (string, bool) {
+	values, ok := f.values[name]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// Set replaces the values of the field name, adding it if needed
+func (f *htmlForm) Set(name string, values ...string) {
+	f.values[name] = values
+}
+
+// Check checks the checkbox name
+func (f *htmlForm) Check(name string) error {
+	value, ok := f.checkboxes[name]
+	if !ok {
+		return fmt.Errorf("no checkbox named %s found in the form", name)
+	}
+	f.values.Set(name, value)
+	return nil
+}
+
+// Options lists the values of the options of the select name
+func (f *htmlForm) Options(name string) []string {
+	var options []string
+	f.selection.Find("select").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return s.AttrOr("name", "") == name
+	}).Find("option").Each(func(i int, o *goquery.Selection) {
+		options = append(options, optionValue(o))
+	})
+	return options
+}
+
+// encode returns the URL, body and content type of the request that
+// submits the form
+func (f *htmlForm) encode() (target string, body []byte, contentType string, err error) {
+	if f.method != "POST" {
+		action := *f.action
+		action.RawQuery = f.values.Encode()
+		return action.String(), nil, "", nil
+	}
+	if f.enctype != "multipart/form-data" {
+		return f.action.String(), []byte(f.values.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, values := range f.values {
+		for _, value := range values {
+			if err = writer.WriteField(name, value); err != nil {
+				return
+			}
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	return f.action.String(), buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// submit sends the form, returning the page Bugzilla answered with
+func (c *Client) submit(form *htmlForm) (*page, error) {
+	target, body, contentType, err := form.encode()
+	if err != nil {
+		return nil, RequestError{err}
+	}
+	var resp *http.Response
+	if contentType == "" {
+		resp, err = c.seriousClient.Get(target)
+	} else {
+		resp, err = c.seriousClient.Post(target, contentType, bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, ConnectionError{c.redactError(err)}
+	}
+	defer resp.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return nil, ConnectionError{err}
+	}
+	if err = c.checkAPIKeyAccepted(answer); err != nil {
+		return nil, err
+	}
+	return parsePage(resp.Request.URL.String(), answer)
+}
@@ -0,0 +1,142 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const formSample = `
+<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN"
+                      "http://www.w3.org/TR/html4/loose.dtd">
+<html lang="en">
+<head>
+<title>Title</title>
+</head>
+<body>
+<form name="changeform" id="changeform" method="post" action="process_bug.cgi">
+  <input type="hidden" name="id" value="1047068">
+  <input type="hidden" name="defined_groups" value="foobaronly">
+  <input type="checkbox" value="foobaronly" name="groups" id="group_10" checked>
+  <input type="checkbox" value="partners" name="groups" id="group_11">
+  <input type="hidden" name="defined_reporter_accessible" value="1">
+  <input type="checkbox" value="1" name="reporter_accessible" id="reporter_accessible" checked="">
+  <input type="hidden" name="defined_cclist_accessible" value="1">
+  <input type="checkbox" value="1" name="cclist_accessible" id="cclist_accessible">
+  <input type="text" name="short_desc" value="something is broken">
+  <input type="text" name="alias" value="ignored" disabled>
+  <fieldset disabled><input type="text" name="deadline" value="2020-01-01"></fieldset>
+  <textarea name="comment"></textarea>
+  <select name="bug_severity">
+    <option value="Critical">Critical</option>
+    <option value="Normal" selected>Normal</option>
+  </select>
+  <select name="rep_platform">
+    <option>x86-64</option>
+    <option>All</option>
+  </select>
+  <select name="cc" multiple="multiple">
+    <option value="one@example.com">one@example.com</option>
+    <option value="two@example.com">two@example.com</option>
+  </select>
+  <select name="keywords" multiple>
+    <option value="a" selected>a</option>
+    <option value="b">b</option>
+    <option value="c" selected>c</option>
+  </select>
+  <input type="radio" name="resolution_choice" value="FIXED">
+  <input type="radio" name="resolution_choice" value="WONTFIX" checked>
+  <input type="submit" value="Save Changes" id="commit">
+</form>
+</body>
+`
+
+func formServer(c *C, queries chan url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, formSample)
+		case "/process_bug.cgi":
+			c.Check(r.Method, Equals, "POST")
+			r.ParseForm()
+			queries <- r.PostForm
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+}
+
+func (cs *clientSuite) TestFormSerialization(c *C) {
+	queries := make(chan url.Values, 1)
+	ts0 := formServer(c, queries)
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.Update(1047068, bugzilla.Changes{AddComment: "a comment"})
+	c.Assert(err, IsNil)
+	c.Check(<-queries, DeepEquals, url.Values{
+		"id":                          {"1047068"},
+		"defined_groups":              {"foobaronly"},
+		"groups":                      {"foobaronly"},
+		"defined_reporter_accessible": {"1"},
+		"reporter_accessible":         {"1"},
+		"defined_cclist_accessible":   {"1"},
+		"short_desc":                  {"something is broken"},
+		"comment":                     {"a comment"},
+		"bug_severity":                {"Normal"},
+		"rep_platform":                {"x86-64"},
+		"keywords":                    {"a", "c"},
+		"resolution_choice":           {"WONTFIX"},
+	})
+}
+
+func (cs *clientSuite) TestFormChanges(c *C) {
+	queries := make(chan url.Values, 1)
+	ts0 := formServer(c, queries)
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.Update(1047068, bugzilla.Changes{SetPlatform: "All",
+		RemoveCc: "two@example.com", SetSeverity: "Critical"})
+	c.Assert(err, IsNil)
+	query := <-queries
+	c.Check(query["rep_platform"], DeepEquals, []string{"All"})
+	c.Check(query["bug_severity"], DeepEquals, []string{"Critical"})
+	c.Check(query["cc"], DeepEquals, []string{"two@example.com"})
+	c.Check(query["removecc"], DeepEquals, []string{"1"})
+	c.Check(query["groups"], DeepEquals, []string{"foobaronly"})
+
+	_, err = bz.Update(1047068, bugzilla.Changes{SetPlatform: "PowerPC"})
+	c.Assert(err, ErrorMatches, ".*invalid rep_platform value: PowerPC")
+}
+
+func (cs *clientSuite) TestUpdateKeepsGroups(c *C) {
+	queries := make(chan url.Values, 1)
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, showBugHtml)
+		case "/process_bug.cgi":
+			r.ParseForm()
+			queries <- r.PostForm
+			io.WriteString(w, changesSubmitted)
+		}
+	}))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.Update(1047068, bugzilla.Changes{AddComment: "a comment"})
+	c.Assert(err, IsNil)
+	query := <-queries
+	c.Check(query["defined_groups"], DeepEquals, []string{"foobaronly"})
+	c.Check(query["groups"], DeepEquals, []string{"foobaronly"})
+	c.Check(query["defined_reporter_accessible"], DeepEquals, []string{"1"})
+	c.Check(query["defined_cclist_accessible"], DeepEquals, []string{"1"})
+	c.Check(query.Get("reporter_accessible"), Equals, "")
+	c.Check(query.Get("cclist_accessible"), Equals, "")
+}
@@ -0,0 +1,92 @@
+package bugzilla
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+type jsonRPCError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type jsonRPCRequest struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     int           `json:"id"`
+}
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *jsonRPCError   `json:"error"`
+}
+
+// jsonRPCParams turns params into a JSON object so that the API key can be
+// added to it
+func (c *Client) jsonRPCParams(params interface{}) (map[string]interface{}, error) {
+	object := make(map[string]interface{})
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("params must be encoded as a JSON object: %v", err)
+		}
+	}
+	if c.Config.APIKey != "" {
+		object["Bugzilla_api_key"] = c.Config.APIKey
+	}
+	return object, nil
+}
+
+// callJSONRPC calls a method of the Bugzilla WebService using jsonrpc.cgi
+// and decodes its result into result. The call is POSTed so that the API
+// key never ends up in a URL.
+func (c *Client) callJSONRPC(method string, params interface{}, result interface{}) error {
+	object, err := c.jsonRPCParams(params)
+	if err != nil {
+		return RequestError{err}
+	}
+	payload, err := json.Marshal(jsonRPCRequest{Method: method, Params: []interface{}{object}, ID: 1})
+	if err != nil {
+		return RequestError{err}
+	}
+
+	url, err := c.getURL("jsonrpc.cgi", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.seriousClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return ConnectionError{c.redactError(err)}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return ConnectionError{err}
+	}
+
+	var decoded jsonRPCResponse
+	err = json.Unmarshal(body, &decoded)
+	if err != nil {
+		if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+			return ConnectionError{fmt.Errorf(http.StatusText(resp.StatusCode))}
+		}
+		return ConnectionError{fmt.Errorf("failed to decode the response of %s: %v", method, err)}
+	}
+	if decoded.Error != nil {
+		return ErrBugzilla{fmt.Errorf("%s (code %d)", c.redact(decoded.Error.Message), decoded.Error.Code)}
+	}
+
+	err = json.Unmarshal(decoded.Result, result)
+	if err != nil {
+		return ConnectionError{fmt.Errorf("failed to decode the result of %s: %v", method, err)}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package bugzilla
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// loginCookie is the cookie Bugzilla sets once the user logged in
+const loginCookie = "Bugzilla_logincookie"
+
+// isLoginPage tells whether Bugzilla answered with the login form instead
+// of the requested page
+func isLoginPage(body []byte) bool {
+	return bytes.Contains(body, []byte(`name="Bugzilla_login"`))
+}
+
+// loggedIn checks whether the cookie jar has a session for the server.
+// Bugzilla expires the login cookie when it finds an invalid session, so
+// the cookie is gone once the session is not valid anymore.
+func (c *Client) loggedIn() bool {
+	base, err := url.Parse(c.Config.BaseURL)
+	if err != nil {
+		return false
+	}
+	for _, cookie := range c.jar.Cookies(base) {
+		if cookie.Name == loginCookie && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Login logs in using the Bugzilla login form, storing the session cookies
+// in the cookie jar shared by all the requests of the Client and in
+// Config.SessionStore. It's called automatically when Config.FormLogin is
+// set.
+func (c *Client) Login() error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.login()
+}
+
+// restoreLogin puts back the cookies of the last login when they are gone
+// from the jar: Bugzilla drops the login cookie when answering a request
+// made with an expired session, even if that answer arrives after another
+// request logged in again.
+func (c *Client) restoreLogin() {
+	if !c.loggedIn() && c.loginCookies != nil {
+		c.setSessionCookies(c.loginCookies)
+	}
+}
+
+// ensureLogin logs in unless another call already did it, returning the
+// generation of the session in use
+func (c *Client) ensureLogin() (int, error) {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	c.restoreLogin()
+	if c.loggedIn() {
+		return c.loginGeneration, nil
+	}
+	err := c.login()
+	return c.loginGeneration, err
+}
+
+// relogin logs in again after the session of generation expired, unless
+// another call already replaced it, returning the generation of the new
+// session
+func (c *Client) relogin(generation int) (int, error) {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	if c.loginGeneration != generation {
+		c.restoreLogin()
+		return c.loginGeneration, nil
+	}
+	err := c.login()
+	return c.loginGeneration, err
+}
+
+func (c *Client) login() error {
+	formURL, err := c.getURL("index.cgi", map[string]string{"GoAheadAndLogIn": "1"})
+	if err != nil {
+		return err
+	}
+	resp, err := c.seriousClient.Get(formURL)
+	if err != nil {
+		return ConnectionError{err}
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return ConnectionError{fmt.Errorf("failed to parse the login page: %v", err)}
+	}
+
+	values := url.Values{}
+	values.Set("Bugzilla_login", c.Config.User)
+	values.Set("Bugzilla_password", c.Config.Password)
+	values.Set("GoAheadAndLogIn", "Log in")
+	// the token is only present in Bugzilla >= 4.4
+	if token, ok := doc.Find("input[name=Bugzilla_login_token]").Attr("value"); ok {
+		values.Set("Bugzilla_login_token", token)
+	}
+
+	loginURL, err := c.getURL("index.cgi", nil)
+	if err != nil {
+		return err
+	}
+	resp, err = c.seriousClient.PostForm(loginURL, values)
+	if err != nil {
+		return ConnectionError{err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return ConnectionError{err}
+	}
+
+	if !c.loggedIn() {
+		message := "no session cookie received"
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err == nil {
+			if title := strings.TrimSpace(doc.Find("title").Text()); title != "" {
+				message = title
+			}
+		}
+		return ErrBugzilla{fmt.Errorf("login failed: %s", c.redact(message))}
+	}
+	c.loginGeneration++
+	c.loginCookies = c.sessionCookies()
+	c.sessionErr = c.saveSession()
+	return nil
+}
+
+// fetch performs a GET and reads the response, limited to 10MiB
+func (c *Client) fetch(url string) ([]byte, error) {
+	resp, err := c.seriousClient.Get(url)
+	if err != nil {
+		return nil, ConnectionError{c.redactError(err)}
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return nil, ConnectionError{fmt.Errorf(http.StatusText(resp.StatusCode))}
+	}
+
+	limitedReader := &io.LimitedReader{R: resp.Body, N: 10 * 1024 * 1024}
+	body, err := ioutil.ReadAll(limitedReader)
+	if err != nil {
+		return nil, ConnectionError{err}
+	}
+	return body, nil
+}
+
+// loginRetries is the number of times a request is retried with a new
+// session. A request answered after another one logged in again can find
+// the new session cookie dropped, hence more than one.
+const loginRetries = 2
+
+// getBody fetches url and returns its contents. With Config.FormLogin, it
+// logs in first and again when the session has expired. With only an API
+// key, it fails when the page was served to an anonymous user.
+func (c *Client) getBody(url string) ([]byte, error) {
+	if !c.Config.FormLogin {
+		body, err := c.fetch(url)
+		if err == nil {
+			err = c.checkAPIKeyAccepted(body)
+		}
+		return body, err
+	}
+	generation, err := c.ensureLogin()
+	if err != nil {
+		return nil, err
+	}
+	for retry := 0; ; retry++ {
+		body, err := c.fetch(url)
+		if err != nil || (c.loggedIn() && !isLoginPage(body)) || retry == loginRetries {
+			return body, err
+		}
+		if generation, err = c.relogin(generation); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// openPage fetches url and parses it as HTML, logging in as getBody()
+// does
+func (c *Client) openPage(url string) (*page, error) {
+	body, err := c.getBody(url)
+	if err != nil {
+		return nil, err
+	}
+	return parsePage(url, body)
+}
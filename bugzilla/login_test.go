@@ -0,0 +1,157 @@
+package bugzilla_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const loginPage = `<html><head><title>Log in to Bugzilla</title></head><body>
+<form name="login" action="index.cgi" method="POST">
+  <input id="Bugzilla_login" name="Bugzilla_login">
+  <input type="password" id="Bugzilla_password" name="Bugzilla_password">
+  <input type="hidden" name="Bugzilla_login_token" value="1554072294-login-token">
+  <input type="submit" name="GoAheadAndLogIn" value="Log in" id="log_in">
+</form>
+</body></html>`
+
+type loginServer struct {
+	c          *C
+	sessions   map[string]bool
+	logins     int
+	submitted  int
+	authHeader bool
+}
+
+func (ls *loginServer) validSession(w http.ResponseWriter, r *http.Request) bool {
+	cookie, err := r.Cookie("Bugzilla_logincookie")
+	if err != nil {
+		return false
+	}
+	if !ls.sessions[cookie.Value] {
+		// Bugzilla drops the invalid login cookie
+		http.SetCookie(w, &http.Cookie{Name: "Bugzilla_logincookie", Value: "", Path: "/", MaxAge: -1})
+		return false
+	}
+	return true
+}
+
+func (ls *loginServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "" {
+		ls.authHeader = true
+	}
+	switch r.URL.Path {
+	case "/index.cgi":
+		if r.Method == "GET" {
+			http.SetCookie(w, &http.Cookie{Name: "Bugzilla_login_request_cookie", Value: "request", Path: "/"})
+			io.WriteString(w, loginPage)
+			return
+		}
+		r.ParseForm()
+		_, err := r.Cookie("Bugzilla_login_request_cookie")
+		ls.c.Check(err, IsNil)
+		ls.c.Check(r.Form.Get("Bugzilla_login_token"), Equals, "1554072294-login-token")
+		if r.Form.Get("Bugzilla_login") != "me" || r.Form.Get("Bugzilla_password") != "letmein" {
+			io.WriteString(w, sampleHtmlError)
+			return
+		}
+		ls.logins++
+		session := fmt.Sprintf("session%d", ls.logins)
+		ls.sessions[session] = true
+		http.SetCookie(w, &http.Cookie{Name: "Bugzilla_login", Value: "1", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "Bugzilla_logincookie", Value: session, Path: "/"})
+		io.WriteString(w, "<html><head><title>Bugzilla Main Page</title></head></html>")
+	case "/show_bug.cgi":
+		valid := ls.validSession(w, r)
+		if r.URL.Query().Get("ctype") == "xml" {
+			if !valid {
+				io.WriteString(w, sampleError)
+				return
+			}
+			io.WriteString(w, bugXml)
+			return
+		}
+		if !valid {
+			io.WriteString(w, loginPage)
+			return
+		}
+		io.WriteString(w, showBugHtml)
+	case "/process_bug.cgi":
+		if !ls.validSession(w, r) {
+			io.WriteString(w, loginPage)
+			return
+		}
+		ls.submitted++
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func makeFormLoginClient(c *C, url, password string) *bugzilla.Client {
+	config := bugzilla.Config{BaseURL: url,
+		User: "me", Password: password, FormLogin: true,
+		SessionStore: &bugzilla.FileSessionStore{Dir: c.MkDir()}}
+	bz, _ := bugzilla.New(config)
+	return bz
+}
+
+func (cs *clientSuite) TestFormLogin(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	bz := makeFormLoginClient(c, ts0.URL, "letmein")
+	bug, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(bug.BugID, Equals, 1047068)
+	c.Check(ls.logins, Equals, 1)
+
+	// the bug form is fetched with the same session
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 1)
+	c.Check(ls.submitted, Equals, 1)
+	c.Check(ls.authHeader, Equals, false)
+}
+
+func (cs *clientSuite) TestFormLoginExpiredSession(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	bz := makeFormLoginClient(c, ts0.URL, "letmein")
+	_, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+
+	ls.sessions = make(map[string]bool)
+	bug, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(bug.BugID, Equals, 1047068)
+	c.Check(ls.logins, Equals, 2)
+
+	ls.sessions = make(map[string]bool)
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 3)
+	c.Check(ls.submitted, Equals, 1)
+}
+
+func (cs *clientSuite) TestFormLoginInvalidPassword(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	bz := makeFormLoginClient(c, ts0.URL, "wrong")
+	bug, err := bz.GetBug(1047068)
+	c.Assert(bug, IsNil)
+	c.Check(err, ErrorMatches, ".*login failed: Invalid Username Or Password.*")
+
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Check(err, ErrorMatches, ".*login failed: Invalid Username Or Password.*")
+	c.Check(ls.submitted, Equals, 0)
+}
@@ -0,0 +1,271 @@
+package bugzilla
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultNeedinfoQuery finds the open bugs with a needinfo requested
+var defaultNeedinfoQuery = map[string]string{
+	"f1": "flagtypes.name", "o1": "substring", "v1": "needinfo?",
+	"resolution": "---",
+}
+
+// StaleNeedinfo is a needinfo request waiting for an answer since Since
+type StaleNeedinfo struct {
+	BugID     int
+	Requestee string
+	Setter    string
+	Since     time.Time
+	Flag      *Flag
+	Bug       *Bug
+}
+
+// StaleNeedinfos has the stale needinfo requests by requestee, oldest
+// first
+type StaleNeedinfos map[string][]*StaleNeedinfo
+
+// NeedinfoQuery selects the needinfo requests checked by
+// FindStaleNeedinfos(): the ones older than OlderThan on the bugs found
+// with Query, which has parameters of buglist.cgi, or with the saved search
+// SavedQuery. Without either, all the open bugs with needinfo requests are
+// checked.
+type NeedinfoQuery struct {
+	Query      map[string]string
+	SavedQuery string
+	OlderThan  time.Duration
+}
+
+// requestedAt finds when flag was last requested as it is now in the
+// activity of the bug
+func requestedAt(activity []Activity, flag *Flag) (time.Time, bool) {
+	text := FormatFlag(flag)
+	var when time.Time
+	found := false
+	for _, change := range activity {
+		if change.Field != "flagtypes.name" || change.AttachID != 0 {
+			continue
+		}
+		for _, added := range strings.Split(normalizeList(change.Added), ", ") {
+			if added == text && !change.When.Before(when) {
+				when, found = change.When, true
+			}
+		}
+	}
+	return when, found
+}
+
+// FindStaleNeedinfos lists the needinfo requests waiting for longer than
+// query.OlderThan. The time of each request is taken from the activity of
+// the bug, or is the creation of the bug when it was requested then.
+func (c *Client) FindStaleNeedinfos(query NeedinfoQuery) (StaleNeedinfos, error) {
+	params := query.Query
+	switch {
+	case query.SavedQuery != "":
+		params = map[string]string{"cmdtype": "runnamed", "namedcmd": query.SavedQuery}
+	case len(params) == 0:
+		params = defaultNeedinfoQuery
+	}
+	found, err := c.searchBugs(params)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	bugs, _, err := c.getBugsInBatches(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	stale := make(StaleNeedinfos)
+	for _, bug := range bugs {
+		var needinfos []*Flag
+		for i := range bug.Flags {
+			flag := &bug.Flags[i]
+			if flag.Name == "needinfo" && flag.Status == "?" && flag.Requestee != "" {
+				needinfos = append(needinfos, flag)
+			}
+		}
+		// nothing on bugs this recent can be stale yet
+		if len(needinfos) == 0 || now.Sub(bug.CreationTS) < query.OlderThan {
+			continue
+		}
+		activity, err := c.GetActivity(bug.BugID)
+		if err != nil {
+			return nil, err
+		}
+		for _, flag := range needinfos {
+			since, ok := requestedAt(activity, flag)
+			if !ok {
+				since = bug.CreationTS
+			}
+			if now.Sub(since) < query.OlderThan {
+				continue
+			}
+			stale[flag.Requestee] = append(stale[flag.Requestee], &StaleNeedinfo{
+				BugID: bug.BugID, Requestee: flag.Requestee, Setter: flag.Setter,
+				Since: since, Flag: flag, Bug: bug})
+		}
+	}
+	for _, needinfos := range stale {
+		sort.SliceStable(needinfos, func(i, j int) bool { return needinfos[i].Since.Before(needinfos[j].Since) })
+	}
+	return stale, nil
+}
+
+// Requestees lists the requestees sorted by name
+func (s StaleNeedinfos) Requestees() []string {
+	requestees := make([]string, 0, len(s))
+	for requestee := range s {
+		requestees = append(requestees, requestee)
+	}
+	sort.Strings(requestees)
+	return requestees
+}
+
+func ageInDays(since, now time.Time) int {
+	return int(now.Sub(since).Hours() / 24)
+}
+
+// WriteReport writes the needinfo requests grouped by requestee, with
+// their age in days at the time now
+func (s StaleNeedinfos) WriteReport(w io.Writer, now time.Time) error {
+	var b strings.Builder
+	for _, requestee := range s.Requestees() {
+		fmt.Fprintf(&b, "%s: %d stale needinfo requests\n", requestee, len(s[requestee]))
+		for _, needinfo := range s[requestee] {
+			fmt.Fprintf(&b, "  bug %d: requested by %s on %s (%d days)\n", needinfo.BugID,
+				needinfo.Setter, needinfo.Since.Format("2006-01-02"), ageInDays(needinfo.Since, now))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// NeedinfoReminder configures RemindNeedinfos(). Comment is posted as a
+// reminder. The requests older than EscalateAfter are escalated instead:
+// needinfo is requested from the manager of the requestee, as found in
+// Managers, EscalationToken is added to the whiteboard and
+// EscalationComment is posted. The comments can have the placeholders
+// {bug_id}, {requestee}, {manager} and {days}.
+//
+// To keep the noise down, the bugs changed in the last Quiet are left
+// alone, which also keeps reminders from being repeated at each run, at
+// most MaxUpdates bugs are changed (all if zero) and there's a Pause
+// between the changes. Quiet is required unless DryRun is set. The bugs
+// with EscalationToken were escalated already and get no more reminders.
+// With DryRun nothing is changed. Each action is written as a line to
+// Report.
+type NeedinfoReminder struct {
+	Comment           string
+	EscalateAfter     time.Duration
+	Managers          map[string]string
+	EscalationToken   string
+	EscalationComment string
+
+	Quiet      time.Duration
+	MaxUpdates int
+	Pause      time.Duration
+	DryRun     bool
+	Report     io.Writer
+}
+
+func hasNeedinfoFrom(bug *Bug, requestee string) bool {
+	for _, flag := range bug.Flags {
+		if flag.Name == "needinfo" && flag.Status == "?" && flag.Requestee == requestee {
+			return true
+		}
+	}
+	return false
+}
+
+// needinfoChanges builds the reminder or the escalation of needinfo. The
+// name of the action tells which one.
+func (r *NeedinfoReminder) needinfoChanges(needinfo *StaleNeedinfo, now time.Time) (string, Changes) {
+	bug := needinfo.Bug
+	manager := r.Managers[needinfo.Requestee]
+	expand := strings.NewReplacer(
+		"{bug_id}", strconv.Itoa(needinfo.BugID),
+		"{requestee}", needinfo.Requestee,
+		"{manager}", manager,
+		"{days}", strconv.Itoa(ageInDays(needinfo.Since, now))).Replace
+
+	if r.EscalateAfter > 0 && now.Sub(needinfo.Since) >= r.EscalateAfter {
+		var changes Changes
+		if manager != "" && !hasNeedinfoFrom(bug, manager) {
+			changes.SetNeedinfo = manager
+		}
+		if r.EscalationToken != "" && !hasToken(bug.StatusWhiteboard, r.EscalationToken) {
+			changes.AddWhiteboardToken = r.EscalationToken
+		}
+		if changes != (Changes{}) {
+			changes.AddComment = expand(r.EscalationComment)
+			return "needinfo-escalation", changes
+		}
+	}
+	if r.EscalationToken != "" && hasToken(bug.StatusWhiteboard, r.EscalationToken) {
+		return "needinfo-reminder", Changes{}
+	}
+	return "needinfo-reminder", Changes{AddComment: expand(r.Comment)}
+}
+
+// RemindNeedinfos posts reminders for the stale needinfo requests, or
+// escalates them, one requestee after the other. It returns the actions
+// done, or planned in a dry run.
+func (c *Client) RemindNeedinfos(stale StaleNeedinfos, options NeedinfoReminder) ([]RuleAction, error) {
+	if options.Comment == "" && options.EscalationToken == "" && len(options.Managers) == 0 {
+		return nil, RequestError{fmt.Errorf("nothing to do: no reminder comment nor escalation")}
+	}
+	if options.Quiet <= 0 && !options.DryRun {
+		return nil, RequestError{fmt.Errorf("a Quiet period is required, or the reminders are repeated at each run")}
+	}
+	now := time.Now()
+	done := []RuleAction{}
+	report := func(format string, args ...interface{}) {
+		if options.Report != nil {
+			fmt.Fprintf(options.Report, format+"\n", args...)
+		}
+	}
+
+	// a bug is changed once per run, even with several requests on it
+	changed := make(map[int]bool)
+	left := 0
+	for _, requestee := range stale.Requestees() {
+		for _, needinfo := range stale[requestee] {
+			if changed[needinfo.BugID] || now.Sub(needinfo.Bug.DeltaTS) < options.Quiet {
+				continue
+			}
+			if options.MaxUpdates > 0 && len(done) >= options.MaxUpdates {
+				left++
+				continue
+			}
+			name, changes := options.needinfoChanges(needinfo, now)
+			if changes == (Changes{}) {
+				continue
+			}
+			changes.DeltaTS, changes.CheckDeltaTS = needinfo.Bug.DeltaTS, true
+			action := RuleAction{Rule: name, BugID: needinfo.BugID, Changes: changes, DryRun: options.DryRun}
+			if !options.DryRun {
+				if len(done) > 0 {
+					time.Sleep(options.Pause)
+				}
+				action.Result, action.Err = c.Update(needinfo.BugID, changes)
+			}
+			changed[needinfo.BugID] = true
+			report("%v", action)
+			done = append(done, action)
+		}
+	}
+	if left > 0 {
+		report("limit of %d updates reached, %d needinfo requests left for later", options.MaxUpdates, left)
+	}
+	return done, nil
+}
@@ -0,0 +1,222 @@
+package bugzilla_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const showActivityHtml = `<!DOCTYPE html>
+<html><head><title>Changes made to bug 1047068</title></head>
+<body><div id="bugzilla-body">
+<p>Back to <a class="bz_bug_link" href="show_bug.cgi?id=1047068">bug 1047068</a></p>
+<table border cellpadding="4">
+  <tr class="column_header">
+    <th>Who</th><th>When</th><th>What</th><th>Removed</th><th>Added</th>
+  </tr>
+  <tr>
+    <td rowspan="2" valign="top">username@foobar.com</td>
+    <td rowspan="2" valign="top">2019-01-10 09:00:00 UTC</td>
+    <td>Flags</td><td>&nbsp;</td><td>needinfo?(username@foobar.com)</td>
+  </tr>
+  <tr><td>CC</td><td>&nbsp;</td><td>username@foobar.com</td></tr>
+  <tr>
+    <td rowspan="1" valign="top">other@foobar.com</td>
+    <td rowspan="1" valign="top">2019-02-01 13:30:00 CET</td>
+    <td>Attachment #800 Flags</td><td>&nbsp;</td><td>review?(username@foobar.com)</td>
+  </tr>
+  <tr>
+    <td rowspan="1" valign="top">username@foobar.com</td>
+    <td rowspan="1" valign="top">2019-03-01 10:00:00 UTC</td>
+    <td>Flags</td><td>&nbsp;</td><td>needinfo?(username@foobar.com), SHIP_STOPPER?(username@foobar.com)</td>
+  </tr>
+</table>
+</div></body></html>`
+
+// needinfoServer finds bugXml, whose needinfos are stale, recording the
+// changes submitted
+type needinfoServer struct {
+	searches []url.Values
+	posts    []url.Values
+}
+
+func (ns *needinfoServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/buglist.cgi":
+		ns.searches = append(ns.searches, r.URL.Query())
+		io.WriteString(w, "bug_id,\"changeddate\"\n1047068,\"2019-03-28 11:40:39\"\n")
+	case "/show_bug.cgi":
+		if r.URL.Query().Get("ctype") == "xml" {
+			io.WriteString(w, strings.Replace(bugXml, "2019-03-27 10:45:20", "2019-03-28 11:40:39", 1))
+			return
+		}
+		io.WriteString(w, showBugHtml)
+	case "/show_activity.cgi":
+		io.WriteString(w, showActivityHtml)
+	case "/process_bug.cgi":
+		r.ParseForm()
+		ns.posts = append(ns.posts, r.PostForm)
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestGetActivity(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(new(needinfoServer).handle))
+	defer ts.Close()
+
+	activity, err := makeClient(ts.URL).GetActivity(1047068)
+	c.Assert(err, IsNil)
+	c.Assert(activity, DeepEquals, []bugzilla.Activity{
+		{Who: "username@foobar.com", When: time.Date(2019, 1, 10, 9, 0, 0, 0, time.UTC),
+			Field: "flagtypes.name", Added: "needinfo?(username@foobar.com)"},
+		{Who: "username@foobar.com", When: time.Date(2019, 1, 10, 9, 0, 0, 0, time.UTC),
+			Field: "cc", Added: "username@foobar.com"},
+		{Who: "other@foobar.com", When: time.Date(2019, 2, 1, 12, 30, 0, 0, time.UTC),
+			Field: "flagtypes.name", AttachID: 800, Added: "review?(username@foobar.com)"},
+		{Who: "username@foobar.com", When: time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC),
+			Field: "flagtypes.name", Added: "needinfo?(username@foobar.com), SHIP_STOPPER?(username@foobar.com)"},
+	})
+}
+
+func (cs *clientSuite) TestGetActivityError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><body><div id="error_msg">You are not authorized to access bug #1047068.</div></body></html>`)
+	}))
+	defer ts.Close()
+
+	_, err := makeClient(ts.URL).GetActivity(1047068)
+	c.Assert(err, ErrorMatches, ".*You are not authorized to access bug #1047068.")
+}
+
+func (cs *clientSuite) TestFindStaleNeedinfos(c *C) {
+	ns := &needinfoServer{}
+	ts := httptest.NewServer(http.HandlerFunc(ns.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	stale, err := bz.FindStaleNeedinfos(bugzilla.NeedinfoQuery{OlderThan: 14 * 24 * time.Hour})
+	c.Assert(err, IsNil)
+	c.Assert(ns.searches[0].Get("v1"), Equals, "needinfo?")
+	c.Assert(stale.Requestees(), DeepEquals, []string{"username@foobar.com"})
+	needinfos := stale["username@foobar.com"]
+	c.Assert(needinfos, HasLen, 2)
+	c.Assert(needinfos[0].BugID, Equals, 1047068)
+	c.Assert(needinfos[0].Since, Equals, time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC))
+	c.Assert(needinfos[0].Flag.ID, Equals, 201661)
+
+	var report bytes.Buffer
+	c.Assert(stale.WriteReport(&report, time.Date(2019, 3, 31, 10, 0, 0, 0, time.UTC)), IsNil)
+	c.Assert(report.String(), Equals, `username@foobar.com: 2 stale needinfo requests
+  bug 1047068: requested by username@foobar.com on 2019-03-01 (30 days)
+  bug 1047068: requested by username@foobar.com on 2019-03-01 (30 days)
+`)
+
+	stale, err = bz.FindStaleNeedinfos(bugzilla.NeedinfoQuery{SavedQuery: "My needinfos",
+		OlderThan: 100 * 365 * 24 * time.Hour})
+	c.Assert(err, IsNil)
+	c.Assert(stale, HasLen, 0)
+	c.Assert(ns.searches[1].Get("namedcmd"), Equals, "My needinfos")
+}
+
+func (cs *clientSuite) TestRemindNeedinfos(c *C) {
+	ns := &needinfoServer{}
+	ts := httptest.NewServer(http.HandlerFunc(ns.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	stale, err := bz.FindStaleNeedinfos(bugzilla.NeedinfoQuery{OlderThan: 14 * 24 * time.Hour})
+	c.Assert(err, IsNil)
+
+	reminder := bugzilla.NeedinfoReminder{
+		Comment:           "{requestee}, any news? Waiting since {days} days.",
+		EscalateAfter:     100 * 365 * 24 * time.Hour,
+		Managers:          map[string]string{"username@foobar.com": "boss@foobar.com"},
+		EscalationToken:   "needinfo:escalated",
+		EscalationComment: "Asking {manager} as {requestee} didn't answer.",
+		DryRun:            true,
+	}
+	var report bytes.Buffer
+	reminder.Report = &report
+	actions, err := bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	// the two requests are on the same bug
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Rule, Equals, "needinfo-reminder")
+	c.Assert(actions[0].Changes.AddComment, Matches, `username@foobar.com, any news\? Waiting since \d+ days.`)
+	c.Assert(report.String(), Equals, "rule needinfo-reminder: bug 1047068: comment (dry run)\n")
+	c.Assert(ns.posts, HasLen, 0)
+
+	reminder.EscalateAfter = 14 * 24 * time.Hour
+	reminder.DryRun = false
+	_, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, ErrorMatches, ".*a Quiet period is required.*")
+	c.Assert(ns.posts, HasLen, 0)
+
+	reminder.Quiet = 24 * time.Hour
+	report.Reset()
+	actions, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Rule, Equals, "needinfo-escalation")
+	c.Assert(actions[0].Err, IsNil)
+	c.Assert(actions[0].Changes.SetNeedinfo, Equals, "boss@foobar.com")
+	c.Assert(actions[0].Changes.AddWhiteboardToken, Equals, "needinfo:escalated")
+	c.Assert(actions[0].Changes.AddComment, Equals, "Asking boss@foobar.com as username@foobar.com didn't answer.")
+	c.Assert(ns.posts, HasLen, 1)
+	c.Assert(ns.posts[0].Get("status_whiteboard"), Equals, "wasZZ:48626  zzz     openZZ:54027 needinfo:escalated")
+	c.Assert(ns.posts[0].Get("comment"), Equals, "Asking boss@foobar.com as username@foobar.com didn't answer.")
+
+	// once escalated, neither the escalation nor the reminders are
+	// repeated
+	original := stale["username@foobar.com"][0].Bug
+	escalated := *original
+	escalated.StatusWhiteboard += " needinfo:escalated"
+	escalated.Flags = append(escalated.Flags, bugzilla.Flag{Name: "needinfo", Status: "?", Requestee: "boss@foobar.com"})
+	for _, needinfo := range stale["username@foobar.com"] {
+		needinfo.Bug = &escalated
+	}
+	reminder.DryRun = true
+	actions, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 0)
+	reminder.EscalateAfter = 100 * 365 * 24 * time.Hour
+	actions, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 0)
+	reminder.EscalateAfter = 14 * 24 * time.Hour
+	for _, needinfo := range stale["username@foobar.com"] {
+		needinfo.Bug = original
+	}
+
+	// rate limits
+	reminder.DryRun = true
+	reminder.MaxUpdates = 1
+	other := *stale["username@foobar.com"][0]
+	otherBug := *other.Bug
+	otherBug.BugID = 1047069
+	other.BugID, other.Bug, other.Requestee = otherBug.BugID, &otherBug, "other@foobar.com"
+	stale["other@foobar.com"] = []*bugzilla.StaleNeedinfo{&other}
+	report.Reset()
+	actions, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(report.String(), Matches, "(?s).*limit of 1 updates reached, 2 needinfo requests left for later\n")
+
+	reminder.MaxUpdates = 0
+	reminder.Quiet = 100 * 365 * 24 * time.Hour
+	actions, err = bz.RemindNeedinfos(stale, reminder)
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 0)
+
+	_, err = bz.RemindNeedinfos(stale, bugzilla.NeedinfoReminder{})
+	c.Assert(err, ErrorMatches, ".*nothing to do.*")
+}
@@ -0,0 +1,157 @@
+package bugzilla
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FlagRequest is a pending flag request, as listed by request.cgi.
+// AttachID and AttachmentDesc are only set for attachment flags and
+// Requestee is empty when anyone can answer.
+type FlagRequest struct {
+	Flag           string    `json:"flag"`
+	Requester      User      `json:"requester"`
+	Requestee      User      `json:"requestee"`
+	BugID          int       `json:"bug_id"`
+	Summary        string    `json:"summary"`
+	AttachID       int       `json:"attach_id,omitempty"`
+	AttachmentDesc string    `json:"attachment_desc,omitempty"`
+	Created        time.Time `json:"created"`
+}
+
+// RequestFilter selects the flag requests listed by GetRequests(). Empty
+// fields are not used for filtering; Flag is the name of the flag type, as
+// in "needinfo".
+type RequestFilter struct {
+	Requester string
+	Requestee string
+	Product   string
+	Component string
+	Flag      string
+}
+
+// linkedItem reads a cell such as "1047068: L4: test cloud bug" linking to
+// the bug or attachment, whose id is taken from the link
+func linkedItem(cell *goquery.Selection) (int, string) {
+	link := cell.Find("a").First()
+	u, err := url.Parse(link.AttrOr("href", ""))
+	if link.Length() == 0 || err != nil {
+		return 0, ""
+	}
+	id, _ := strconv.Atoi(u.Query().Get("id"))
+	text := cellText(link)
+	if prefix := strconv.Itoa(id) + ":"; strings.HasPrefix(text, prefix) {
+		text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+	}
+	return id, text
+}
+
+// setRequestColumn fills the field of request shown in the column named
+// header, either in the table or as the heading of the group of requests
+func setRequestColumn(request *FlagRequest, header string, cell *goquery.Selection, text string) error {
+	var err error
+	switch header {
+	case "Flag":
+		request.Flag = text
+	case "Requester":
+		request.Requester = parseUser(text)
+	case "Requestee":
+		if text != "" && text != "anyone" {
+			request.Requestee = parseUser(text)
+		}
+	case "Bug":
+		if cell != nil {
+			request.BugID, request.Summary = linkedItem(cell)
+		}
+	case "Attachment":
+		if cell != nil {
+			request.AttachID, request.AttachmentDesc = linkedItem(cell)
+		}
+	case "Created":
+		request.Created, err = parsePageTime(text)
+	}
+	return err
+}
+
+// parseRequests reads the tables of request.cgi, one for each group of
+// requests, which has the value of the grouping column in the heading
+// before it, as in "Flag: needinfo"
+func parseRequests(p *page) ([]FlagRequest, error) {
+	if msg := cellText(p.doc.Find("#error_msg")); msg != "" {
+		return nil, ErrBugzilla{fmt.Errorf("%s", msg)}
+	}
+	requests := []FlagRequest{}
+	var err error
+	p.doc.Find("table.requests").EachWithBreak(func(i int, table *goquery.Selection) bool {
+		var group, groupValue string
+		heading := table.PrevAllFiltered("h3").First()
+		if parts := strings.SplitN(cellText(heading), ":", 2); len(parts) == 2 {
+			group, groupValue = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		var headers []string
+		table.Find("th").Each(func(i int, th *goquery.Selection) {
+			headers = append(headers, cellText(th))
+		})
+		table.Find("tr").EachWithBreak(func(i int, row *goquery.Selection) bool {
+			cells := row.Find("td")
+			if cells.Length() == 0 {
+				return true
+			}
+			var request FlagRequest
+			if group != "" {
+				if err = setRequestColumn(&request, group, nil, groupValue); err != nil {
+					return false
+				}
+			}
+			cells.EachWithBreak(func(i int, cell *goquery.Selection) bool {
+				if i < len(headers) {
+					err = setRequestColumn(&request, headers[i], cell, cellText(cell))
+				}
+				return err == nil
+			})
+			if err != nil {
+				return false
+			}
+			requests = append(requests, request)
+			return true
+		})
+		return err == nil
+	})
+	if err != nil {
+		return nil, ErrBugzilla{fmt.Errorf("unexpected request queue: %v", err)}
+	}
+	return requests, nil
+}
+
+// GetRequests lists the pending flag requests of bugs and attachments
+// matching filter, as shown by the "My Requests" page
+func (c *Client) GetRequests(filter RequestFilter) ([]FlagRequest, error) {
+	params := map[string]string{"action": "queue", "status": "?", "type": "all",
+		"group": "type", "do_union": "0"}
+	values := []struct{ name, value string }{
+		{"requester", filter.Requester},
+		{"requestee", filter.Requestee},
+		{"product", filter.Product},
+		{"component", filter.Component},
+		{"type", filter.Flag},
+	}
+	for _, value := range values {
+		if value.value != "" {
+			params[value.name] = value.value
+		}
+	}
+	url, err := c.getURL("request.cgi", params)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.openPage(url)
+	if err != nil {
+		return nil, err
+	}
+	return parseRequests(p)
+}
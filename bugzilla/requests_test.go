@@ -0,0 +1,105 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const requestQueueHtml = `<!DOCTYPE html>
+<html><head><title>Request Queue</title></head>
+<body><div id="bugzilla-body">
+<form action="request.cgi" method="get"><input type="hidden" name="action" value="queue"></form>
+
+<h3>Flag: needinfo</h3>
+<table class="requests" cellspacing="0" cellpadding="4" border="1">
+  <tr>
+    <th>Requester</th><th>Requestee</th><th>Bug</th><th>Attachment</th><th>Created</th>
+  </tr>
+  <tr>
+    <td>Firstname Lastname &lt;user@foobar.com&gt;</td>
+    <td>Lastname, Other &lt;other@foobar.com&gt;</td>
+    <td><a href="show_bug.cgi?id=1047068">1047068: L4: test cloud bug</a></td>
+    <td>N/A</td>
+    <td>2019-03-01 10:00 UTC</td>
+  </tr>
+</table>
+
+<h3>Flag: review</h3>
+<table class="requests" cellspacing="0" cellpadding="4" border="1">
+  <tr>
+    <th>Requester</th><th>Requestee</th><th>Bug</th><th>Attachment</th><th>Created</th>
+  </tr>
+  <tr>
+    <td>user@foobar.com</td>
+    <td>anyone</td>
+    <td><a href="show_bug.cgi?id=1047069">1047069: Frobnicator crashes</a></td>
+    <td><a href="attachment.cgi?id=800&amp;action=edit">800: fix the crash</a></td>
+    <td>2019-03-02 12:30 CET</td>
+  </tr>
+</table>
+</div></body></html>`
+
+func (cs *clientSuite) TestGetRequests(c *C) {
+	var queries []url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		if r.URL.Path != "/request.cgi" {
+			http.Error(w, "Unimplemented", 500)
+			return
+		}
+		io.WriteString(w, requestQueueHtml)
+	}))
+	defer ts.Close()
+
+	requests, err := makeClient(ts.URL).GetRequests(bugzilla.RequestFilter{
+		Requestee: "other@foobar.com", Product: "foobar Frobnicator Cloud 7"})
+	c.Assert(err, IsNil)
+	c.Assert(queries, HasLen, 1)
+	c.Assert(queries[0].Get("action"), Equals, "queue")
+	c.Assert(queries[0].Get("requestee"), Equals, "other@foobar.com")
+	c.Assert(queries[0].Get("product"), Equals, "foobar Frobnicator Cloud 7")
+	c.Assert(queries[0].Get("type"), Equals, "all")
+	c.Assert(queries[0].Get("requester"), Equals, "")
+
+	c.Assert(requests, DeepEquals, []bugzilla.FlagRequest{
+		{
+			Flag:      "needinfo",
+			Requester: bugzilla.User{Name: "Firstname Lastname", Email: "user@foobar.com"},
+			Requestee: bugzilla.User{Name: "Lastname, Other", Email: "other@foobar.com"},
+			BugID:     1047068,
+			Summary:   "L4: test cloud bug",
+			Created:   time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			Flag:           "review",
+			Requester:      bugzilla.User{Email: "user@foobar.com"},
+			BugID:          1047069,
+			Summary:        "Frobnicator crashes",
+			AttachID:       800,
+			AttachmentDesc: "fix the crash",
+			Created:        time.Date(2019, 3, 2, 11, 30, 0, 0, time.UTC),
+		},
+	})
+}
+
+func (cs *clientSuite) TestGetRequestsFlag(c *C) {
+	var queries []url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		io.WriteString(w, `<html><body><div id="bugzilla-body"><p>No requests.</p></div></body></html>`)
+	}))
+	defer ts.Close()
+
+	requests, err := makeClient(ts.URL).GetRequests(bugzilla.RequestFilter{
+		Requester: "user@foobar.com", Flag: "needinfo"})
+	c.Assert(err, IsNil)
+	c.Assert(requests, HasLen, 0)
+	c.Assert(queries[0].Get("type"), Equals, "needinfo")
+	c.Assert(queries[0].Get("requester"), Equals, "user@foobar.com")
+}
@@ -0,0 +1,360 @@
+package bugzilla
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuleDuration is a duration written in rules as in time.ParseDuration(),
+// or as a number of days or weeks, as in "3d" or "2w"
+type RuleDuration time.Duration
+
+// UnmarshalJSON reads a duration such as "72h", "3d" or "2w"
+func (d *RuleDuration) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return err
+	}
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(text, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(text, suffix))
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", text)
+			}
+			*d = RuleDuration(time.Duration(n) * unit)
+			return nil
+		}
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = RuleDuration(parsed)
+	return nil
+}
+
+// RuleMatch has the conditions a bug must meet for a rule to apply to it.
+// Empty conditions are ignored; the lists of values match when the bug has
+// any of them, except Keywords, which must all be there. Whiteboard is a
+// whitespace separated token of the status whiteboard and Flag is the
+// beginning of a flag as formatted by FormatFlag(), as in "needinfo?".
+type RuleMatch struct {
+	Product       []string     `json:"product"`
+	Component     []string     `json:"component"`
+	Status        []string     `json:"status"`
+	Resolution    []string     `json:"resolution"`
+	Priority      []string     `json:"priority"`
+	Severity      []string     `json:"severity"`
+	Assignee      []string     `json:"assignee"`
+	Keywords      []string     `json:"keywords"`
+	NoKeywords    []string     `json:"no_keywords"`
+	Whiteboard    string       `json:"whiteboard"`
+	NoWhiteboard  string       `json:"no_whiteboard"`
+	Flag          string       `json:"flag"`
+	NoFlag        string       `json:"no_flag"`
+	UnchangedFor  RuleDuration `json:"unchanged_for"`
+	CreatedBefore RuleDuration `json:"created_before"`
+}
+
+// RuleActions are the changes done by a rule. The texts can have the
+// placeholders {bug_id}, {assignee}, {reporter}, {qa_contact} and
+// {component_owner}, the last one taken from RuleSet.ComponentOwners.
+// AddWhiteboardToken is a marker: once it is in the whiteboard, or once
+// the requestee of SetNeedinfo has a needinfo request, the rule is not
+// applied again to the bug. A comment needs one of them, or it would be
+// posted on every run.
+type RuleActions struct {
+	SetNeedinfo        string `json:"set_needinfo"`
+	AddComment         string `json:"add_comment"`
+	CommentIsPrivate   bool   `json:"comment_is_private"`
+	SetAssignee        string `json:"set_assignee"`
+	SetPriority        string `json:"set_priority"`
+	SetSeverity        string `json:"set_severity"`
+	SetStatus          string `json:"set_status"`
+	SetResolution      string `json:"set_resolution"`
+	AddCc              string `json:"add_cc"`
+	AddWhiteboardToken string `json:"add_whiteboard_token"`
+}
+
+// Rule is an automation rule: the bugs found with Query, which has
+// parameters of buglist.cgi such as {"product": "X", "bug_status": "NEW"},
+// or with the saved search SavedQuery, that also meet Match get the
+// changes in Actions
+type Rule struct {
+	Name       string            `json:"name"`
+	Query      map[string]string `json:"query"`
+	SavedQuery string            `json:"saved_query"`
+	Match      RuleMatch         `json:"match"`
+	Actions    RuleActions       `json:"actions"`
+}
+
+// RuleSet is a list of rules, as read by LoadRules(). ComponentOwners maps
+// "product/component", or just "product", to the email of its owner.
+type RuleSet struct {
+	Rules           []Rule            `json:"rules"`
+	ComponentOwners map[string]string `json:"component_owners"`
+}
+
+// LoadRules reads a RuleSet written in JSON
+func LoadRules(source io.Reader) (*RuleSet, error) {
+	var rules RuleSet
+	decoder := json.NewDecoder(source)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, RequestError{fmt.Errorf("invalid rules: %v", err)}
+	}
+	names := make(map[string]bool)
+	for _, rule := range rules.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return nil, RequestError{fmt.Errorf("invalid rules: each rule needs a unique name")}
+		}
+		names[rule.Name] = true
+		if (rule.SavedQuery == "") == (len(rule.Query) == 0) {
+			return nil, RequestError{fmt.Errorf("invalid rule %s: it needs either a query or a saved query", rule.Name)}
+		}
+		if rule.Actions == (RuleActions{}) {
+			return nil, RequestError{fmt.Errorf("invalid rule %s: it has no actions", rule.Name)}
+		}
+		if rule.Actions.AddComment != "" && rule.Actions.SetNeedinfo == "" && rule.Actions.AddWhiteboardToken == "" {
+			return nil, RequestError{fmt.Errorf("invalid rule %s: a comment needs set_needinfo or add_whiteboard_token", rule.Name)}
+		}
+	}
+	return &rules, nil
+}
+
+func matchesAny(value string, values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasToken(text, token string) bool {
+	for _, field := range strings.Fields(text) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlag(bug *Bug, prefix string) bool {
+	for i := range bug.Flags {
+		if strings.HasPrefix(FormatFlag(&bug.Flags[i]), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches tells whether bug meets all the conditions at the time now
+func (m *RuleMatch) Matches(bug *Bug, now time.Time) bool {
+	if !matchesAny(bug.Product, m.Product) || !matchesAny(bug.Component, m.Component) ||
+		!matchesAny(bug.BugStatus, m.Status) || !matchesAny(bug.Resolution, m.Resolution) ||
+		!matchesAny(bug.Priority, m.Priority) || !matchesAny(bug.BugSeverity, m.Severity) ||
+		!matchesAny(bug.AssignedTo.Email, m.Assignee) {
+		return false
+	}
+	keywords := strings.Join(splitKeywords(bug.Keywords), " ")
+	for _, keyword := range m.Keywords {
+		if !hasToken(keywords, keyword) {
+			return false
+		}
+	}
+	for _, keyword := range m.NoKeywords {
+		if hasToken(keywords, keyword) {
+			return false
+		}
+	}
+	if m.Whiteboard != "" && !hasToken(bug.StatusWhiteboard, m.Whiteboard) ||
+		m.NoWhiteboard != "" && hasToken(bug.StatusWhiteboard, m.NoWhiteboard) {
+		return false
+	}
+	if m.Flag != "" && !hasFlag(bug, m.Flag) || m.NoFlag != "" && hasFlag(bug, m.NoFlag) {
+		return false
+	}
+	if m.UnchangedFor != 0 && now.Sub(bug.DeltaTS) < time.Duration(m.UnchangedFor) {
+		return false
+	}
+	if m.CreatedBefore != 0 && now.Sub(bug.CreationTS) < time.Duration(m.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// changes expands the actions for bug. The changes are empty when the
+// actions have nothing left to do.
+func (rs *RuleSet) changes(actions *RuleActions, bug *Bug) (Changes, error) {
+	owner, ok := rs.ComponentOwners[bug.Product+"/"+bug.Component]
+	if !ok {
+		owner = rs.ComponentOwners[bug.Product]
+	}
+	var missingOwner bool
+	replacer := strings.NewReplacer(
+		"{bug_id}", strconv.Itoa(bug.BugID),
+		"{assignee}", bug.AssignedTo.Email,
+		"{reporter}", bug.Reporter.Email,
+		"{qa_contact}", bug.QAContact.Email,
+		"{component_owner}", owner)
+	expand := func(text string) string {
+		if owner == "" && strings.Contains(text, "{component_owner}") {
+			missingOwner = true
+		}
+		return replacer.Replace(text)
+	}
+
+	changes := Changes{
+		SetNeedinfo:      expand(actions.SetNeedinfo),
+		AddComment:       expand(actions.AddComment),
+		CommentIsPrivate: actions.CommentIsPrivate,
+		SetAssignee:      expand(actions.SetAssignee),
+		SetPriority:      actions.SetPriority,
+		SetSeverity:      actions.SetSeverity,
+		SetStatus:        actions.SetStatus,
+		SetResolution:    actions.SetResolution,
+		AddCc:            expand(actions.AddCc),
+	}
+	token := expand(actions.AddWhiteboardToken)
+	if missingOwner {
+		return Changes{}, RequestError{fmt.Errorf("no component owner known for %s/%s", bug.Product, bug.Component)}
+	}
+	// the marker token or the needinfo already there mean that the rule
+	// was applied before, doing it again would repeat the comment
+	if (token != "" && hasToken(bug.StatusWhiteboard, token)) ||
+		(changes.SetNeedinfo != "" && hasNeedinfoFrom(bug, changes.SetNeedinfo)) {
+		return Changes{}, nil
+	}
+	changes.AddWhiteboardToken = token
+	if changes == (Changes{CommentIsPrivate: changes.CommentIsPrivate}) {
+		return Changes{}, nil
+	}
+	// rules are evaluated on a fresh copy of the bug, anything changed
+	// since then is a reason to look at it again
+	changes.DeltaTS, changes.CheckDeltaTS = bug.DeltaTS, true
+	return changes, nil
+}
+
+// RuleAction is a change done, or planned in a dry run, by a rule
+type RuleAction struct {
+	Rule    string
+	BugID   int
+	Changes Changes
+	DryRun  bool
+	Result  *UpdateResult
+	Err     error
+}
+
+func describeChanges(changes *Changes) string {
+	var parts []string
+	values := []struct{ name, value string }{
+		{"needinfo", changes.SetNeedinfo},
+		{"assignee", changes.SetAssignee},
+		{"priority", changes.SetPriority},
+		{"severity", changes.SetSeverity},
+		{"status", changes.SetStatus},
+		{"resolution", changes.SetResolution},
+		{"whiteboard", changes.SetWhiteboard},
+		{"token", changes.AddWhiteboardToken},
+		{"cc", changes.AddCc},
+	}
+	for _, value := range values {
+		if value.value != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", value.name, value.value))
+		}
+	}
+	if changes.AddComment != "" {
+		parts = append(parts, "comment")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (a RuleAction) String() string {
+	text := fmt.Sprintf("rule %s: bug %d: %s", a.Rule, a.BugID, describeChanges(&a.Changes))
+	switch {
+	case a.Err != nil:
+		text += fmt.Sprintf(": failed: %v", a.Err)
+	case a.DryRun:
+		text += " (dry run)"
+	}
+	return text
+}
+
+// Evaluate lists the actions of all the rules matching bug at the time
+// now, without changing anything
+func (rs *RuleSet) Evaluate(bug *Bug, now time.Time) []RuleAction {
+	var actions []RuleAction
+	for i := range rs.Rules {
+		rule := &rs.Rules[i]
+		if !rule.Match.Matches(bug, now) {
+			continue
+		}
+		changes, err := rs.changes(&rule.Actions, bug)
+		if err == nil && changes == (Changes{}) {
+			continue
+		}
+		actions = append(actions, RuleAction{Rule: rule.Name, BugID: bug.BugID,
+			Changes: changes, Err: err})
+	}
+	return actions
+}
+
+// RuleOptions changes how RunRules() works. With DryRun nothing is
+// changed. Each action is written as a line to Log.
+type RuleOptions struct {
+	DryRun bool
+	Log    io.Writer
+}
+
+// RunRules searches the bugs of each rule and applies its actions to the
+// ones that match, one rule after the other. The actions that failed have
+// Err set; the error is only returned when a search fails.
+func (c *Client) RunRules(rules *RuleSet, options RuleOptions) ([]RuleAction, error) {
+	now := time.Now()
+	done := []RuleAction{}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		params := rule.Query
+		if rule.SavedQuery != "" {
+			params = map[string]string{"cmdtype": "runnamed", "namedcmd": rule.SavedQuery}
+		}
+		found, err := c.searchBugs(params)
+		if err != nil {
+			return done, err
+		}
+		var ids []int
+		for id := range found {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		bugs, _, err := c.getBugsInBatches(ids)
+		if err != nil {
+			return done, err
+		}
+
+		single := RuleSet{Rules: []Rule{*rule}, ComponentOwners: rules.ComponentOwners}
+		for _, bug := range bugs {
+			for _, action := range single.Evaluate(bug, now) {
+				action.DryRun = options.DryRun
+				if action.Err == nil && !options.DryRun {
+					action.Result, action.Err = c.Update(action.BugID, action.Changes)
+				}
+				if options.Log != nil {
+					fmt.Fprintln(options.Log, action)
+				}
+				done = append(done, action)
+			}
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,244 @@
+package bugzilla_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const sampleRules = `{
+  "component_owners": {
+    "foobar Frobnicator Cloud 7/Frob": "owner@foobar.com",
+    "Other Product": "other-owner@foobar.com"
+  },
+  "rules": [
+    {
+      "name": "untriaged",
+      "query": {"product": "foobar Frobnicator Cloud 7", "bug_status": "NEW"},
+      "match": {
+        "status": ["NEW", "CONFIRMED"],
+        "assignee": ["nobody@foobar.com"],
+        "unchanged_for": "3d",
+        "no_flag": "needinfo?"
+      },
+      "actions": {
+        "set_needinfo": "{component_owner}",
+        "add_comment": "Bug {bug_id} is waiting for triage.",
+        "add_whiteboard_token": "triage:pending"
+      }
+    },
+    {
+      "name": "frob-wasZZ",
+      "saved_query": "Frob bugs",
+      "match": {"whiteboard": "wasZZ:48626", "keywords": ["SECOND_KEYWORD"]},
+      "actions": {"add_whiteboard_token": "frob:seen"}
+    }
+  ]
+}`
+
+func untriagedBug() *bugzilla.Bug {
+	return &bugzilla.Bug{
+		BugID:            1047068,
+		Product:          "foobar Frobnicator Cloud 7",
+		Component:        "Frob",
+		BugStatus:        "NEW",
+		AssignedTo:       bugzilla.User{Email: "nobody@foobar.com"},
+		StatusWhiteboard: "wasZZ:48626",
+		DeltaTS:          time.Date(2019, 3, 27, 10, 45, 20, 0, time.UTC),
+	}
+}
+
+func (cs *clientSuite) TestLoadRules(c *C) {
+	rules, err := bugzilla.LoadRules(strings.NewReader(sampleRules))
+	c.Assert(err, IsNil)
+	c.Assert(rules.Rules, HasLen, 2)
+	c.Assert(time.Duration(rules.Rules[0].Match.UnchangedFor), Equals, 72*time.Hour)
+	c.Assert(rules.Rules[1].SavedQuery, Equals, "Frob bugs")
+
+	invalid := []struct{ rules, err string }{
+		{`{"rules": [{"name": "x", "actions": {"add_cc": "a@b.c"}}]}`, ".*either a query or a saved query"},
+		{`{"rules": [{"name": "x", "saved_query": "q"}]}`, ".*it has no actions"},
+		{`{"rules": [{"saved_query": "q", "actions": {"add_cc": "a@b.c"}}]}`, ".*unique name"},
+		{`{"rules": [{"name": "x", "saved_query": "q", "match": {"unchanged_for": "soon"}}]}`, `.*invalid duration "soon"`},
+		{`{"rules": [{"name": "x", "saved_query": "q", "actions": {"set_neddinfo": "a@b.c"}}]}`, `.*unknown field "set_neddinfo"`},
+		{`{"rules": [{"name": "x", "saved_query": "q", "actions": {"add_comment": "ping"}}]}`, ".*a comment needs set_needinfo or add_whiteboard_token"},
+	}
+	for _, test := range invalid {
+		_, err := bugzilla.LoadRules(strings.NewReader(test.rules))
+		c.Assert(err, ErrorMatches, test.err)
+	}
+}
+
+func (cs *clientSuite) TestRuleEvaluate(c *C) {
+	rules, err := bugzilla.LoadRules(strings.NewReader(sampleRules))
+	c.Assert(err, IsNil)
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	bug := untriagedBug()
+
+	actions := rules.Evaluate(bug, now)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Rule, Equals, "untriaged")
+	c.Assert(actions[0].Err, IsNil)
+	changes := actions[0].Changes
+	c.Assert(changes.SetNeedinfo, Equals, "owner@foobar.com")
+	c.Assert(changes.AddComment, Equals, "Bug 1047068 is waiting for triage.")
+	c.Assert(changes.AddWhiteboardToken, Equals, "triage:pending")
+	c.Assert(changes.SetWhiteboard, Equals, "")
+	c.Assert(changes.CheckDeltaTS, Equals, true)
+	c.Assert(actions[0].String(), Equals, `rule untriaged: bug 1047068: needinfo="owner@foobar.com" token="triage:pending" comment`)
+
+	// too recent
+	c.Assert(rules.Evaluate(bug, bug.DeltaTS.Add(time.Hour)), HasLen, 0)
+
+	// already waiting for someone
+	bug.Flags = []bugzilla.Flag{{Name: "needinfo", Status: "?", Requestee: "user@foobar.com"}}
+	c.Assert(rules.Evaluate(bug, now), HasLen, 0)
+
+	bug = untriagedBug()
+	bug.Component = "Unknown"
+	bug.Product = "Mystery Product"
+	actions = rules.Evaluate(bug, now)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Err, ErrorMatches, ".*no component owner known for Mystery Product/Unknown")
+
+	// the product owner is used when there's none for the component
+	bug.Product = "Other Product"
+	c.Assert(rules.Evaluate(bug, now)[0].Changes.SetNeedinfo, Equals, "other-owner@foobar.com")
+
+	// nothing left to do once the token is there
+	bug = untriagedBug()
+	bug.Keywords = "SECOND_KEYWORD"
+	bug.AssignedTo.Email = "user@foobar.com"
+	actions = rules.Evaluate(bug, now)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Changes.AddWhiteboardToken, Equals, "frob:seen")
+	bug.StatusWhiteboard = "wasZZ:48626 frob:seen"
+	c.Assert(rules.Evaluate(bug, now), HasLen, 0)
+
+	// neither the needinfo nor the comment are repeated once the marker
+	// token or the needinfo are there, even if the rule matches again
+	rules, err = bugzilla.LoadRules(strings.NewReader(`{"rules": [{"name": "ask", "saved_query": "q",
+		"actions": {"set_needinfo": "{assignee}", "add_comment": "Any news?"}}]}`))
+	c.Assert(err, IsNil)
+	bug = untriagedBug()
+	c.Assert(rules.Evaluate(bug, now), HasLen, 1)
+	bug.Flags = []bugzilla.Flag{{Name: "needinfo", Status: "?", Requestee: "nobody@foobar.com"}}
+	c.Assert(rules.Evaluate(bug, now), HasLen, 0)
+	bug.Flags = nil
+	rules.Rules[0].Actions.AddWhiteboardToken = "asked"
+	bug.StatusWhiteboard = "wasZZ:48626 asked"
+	c.Assert(rules.Evaluate(bug, now), HasLen, 0)
+}
+
+// rulesServer finds bugXml with any search, recording the changes
+// submitted. Its delta_ts is the one of showBugHtml unless stale. With
+// keepWhiteboard the whiteboard posted is the one of the bug afterwards.
+type rulesServer struct {
+	stale          bool
+	keepWhiteboard bool
+	whiteboard     string
+	searches       []url.Values
+	posts          []url.Values
+}
+
+func (rs *rulesServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/buglist.cgi":
+		rs.searches = append(rs.searches, r.URL.Query())
+		io.WriteString(w, "bug_id,\"changeddate\"\n1047068,\"2019-03-27 10:45:20\"\n")
+	case "/show_bug.cgi":
+		if r.URL.Query().Get("ctype") == "xml" {
+			bug := bugXml
+			if rs.whiteboard != "" {
+				bug = strings.Replace(bug, "wasZZ:48626  zzz", rs.whiteboard, 1)
+			}
+			if !rs.stale {
+				bug = strings.Replace(bug, "2019-03-27 10:45:20", "2019-03-28 11:40:39", 1)
+			}
+			io.WriteString(w, bug)
+			return
+		}
+		io.WriteString(w, showBugHtml)
+	case "/process_bug.cgi":
+		r.ParseForm()
+		rs.posts = append(rs.posts, r.PostForm)
+		if rs.keepWhiteboard {
+			rs.whiteboard = r.PostForm.Get("status_whiteboard")
+		}
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestRunRules(c *C) {
+	rs := &rulesServer{}
+	ts := httptest.NewServer(http.HandlerFunc(rs.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	rules, err := bugzilla.LoadRules(strings.NewReader(sampleRules))
+	c.Assert(err, IsNil)
+
+	var log bytes.Buffer
+	actions, err := bz.RunRules(rules, bugzilla.RuleOptions{DryRun: true, Log: &log})
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].DryRun, Equals, true)
+	c.Assert(log.String(), Equals, "rule frob-wasZZ: bug 1047068: token=\"frob:seen\" (dry run)\n")
+	c.Assert(rs.posts, HasLen, 0)
+	c.Assert(rs.searches, HasLen, 2)
+	c.Assert(rs.searches[0].Get("product"), Equals, "foobar Frobnicator Cloud 7")
+	c.Assert(rs.searches[1].Get("namedcmd"), Equals, "Frob bugs")
+
+	log.Reset()
+	actions, err = bz.RunRules(rules, bugzilla.RuleOptions{Log: &log})
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Err, IsNil)
+	c.Assert(actions[0].Result, NotNil)
+	c.Assert(log.String(), Equals, "rule frob-wasZZ: bug 1047068: token=\"frob:seen\"\n")
+	c.Assert(rs.posts, HasLen, 1)
+	c.Assert(rs.posts[0].Get("status_whiteboard"), Equals, "wasZZ:48626  zzz     openZZ:54027 frob:seen")
+
+	// the bug changed after it was evaluated
+	rs.stale = true
+	actions, err = bz.RunRules(rules, bugzilla.RuleOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Err, ErrorMatches, ".*mid-air collision.*")
+	c.Assert(rs.posts, HasLen, 1)
+}
+
+func (cs *clientSuite) TestRunRulesTwice(c *C) {
+	rs := &rulesServer{keepWhiteboard: true}
+	ts := httptest.NewServer(http.HandlerFunc(rs.handle))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	rules, err := bugzilla.LoadRules(strings.NewReader(`{"rules": [{
+		"name": "frob-ping", "saved_query": "Frob bugs",
+		"actions": {"add_comment": "Is this still a problem?", "add_whiteboard_token": "frob:pinged"}}]}`))
+	c.Assert(err, IsNil)
+
+	actions, err := bz.RunRules(rules, bugzilla.RuleOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 1)
+	c.Assert(actions[0].Err, IsNil)
+	c.Assert(rs.posts, HasLen, 1)
+	c.Assert(rs.posts[0].Get("comment"), Equals, "Is this still a problem?")
+	c.Assert(rs.posts[0].Get("status_whiteboard"), Equals, "wasZZ:48626  zzz     openZZ:54027 frob:pinged")
+
+	// the token marks the bug as done, the comment is not posted again
+	actions, err = bz.RunRules(rules, bugzilla.RuleOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(actions, HasLen, 0)
+	c.Assert(rs.posts, HasLen, 1)
+}
@@ -0,0 +1,198 @@
+package bugzilla
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SessionCookie is a cookie kept in a Session
+type SessionCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Session has the cookies that identify a logged in user: Bugzilla_login
+// and Bugzilla_logincookie, the login token
+type Session struct {
+	BaseURL string          `json:"base_url"`
+	User    string          `json:"user"`
+	Cookies []SessionCookie `json:"cookies"`
+	SavedAt time.Time       `json:"saved_at"`
+}
+
+// SessionStore keeps sessions across process runs, so that a new Client
+// can reuse the session of a previous one instead of logging in again. Load
+// returns a nil *Session when there is nothing stored for key.
+type SessionStore interface {
+	Load(key string) (*Session, error)
+	Save(key string, session *Session) error
+}
+
+// FileSessionStore stores each session in a JSON file only readable by
+// the user. Dir defaults to the "go-suseapi/sessions" directory inside
+// os.UserCacheDir().
+type FileSessionStore struct {
+	Dir string
+}
+
+func (s *FileSessionStore) dir() (string, error) {
+	if s.Dir != "" {
+		return s.Dir, nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "go-suseapi", "sessions"), nil
+}
+
+func (s *FileSessionStore) path(key string) (string, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// Load reads the session stored for key. Files that can be read by other
+// users are refused.
+func (s *FileSessionStore) Load(key string) (*Session, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("refusing to use %s: it is accessible by other users (mode %v)", path, info.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return &session, nil
+}
+
+// Save writes the session for key, replacing the previous one atomically
+func (s *FileSessionStore) Save(key string, session *Session) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".session-")
+	if err != nil {
+		return err
+	}
+	// TempFile creates the file with mode 0600
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Client) sessionKey() string {
+	return c.Config.BaseURL + "\x00" + c.Config.User
+}
+
+// setSessionCookies puts cookies into the cookie jar
+func (c *Client) setSessionCookies(cookies []SessionCookie) {
+	base, err := url.Parse(c.Config.BaseURL)
+	if err != nil {
+		return
+	}
+	cookiePath := base.Path
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+	var jarCookies []*http.Cookie
+	for _, cookie := range cookies {
+		jarCookies = append(jarCookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: cookiePath})
+	}
+	c.jar.SetCookies(base, jarCookies)
+}
+
+// sessionCookies lists the cookies in the jar for the server
+func (c *Client) sessionCookies() []SessionCookie {
+	base, err := url.Parse(c.Config.BaseURL)
+	if err != nil {
+		return nil
+	}
+	var cookies []SessionCookie
+	for _, cookie := range c.jar.Cookies(base) {
+		cookies = append(cookies, SessionCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+// restoreSession puts the cookies of the stored session, if any, into the
+// cookie jar. Broken or unreadable sessions just lead to a new login, the
+// error is kept for SessionError().
+func (c *Client) restoreSession() {
+	store := c.Config.SessionStore
+	if store == nil || !c.Config.FormLogin {
+		return
+	}
+	session, err := store.Load(c.sessionKey())
+	if err != nil {
+		c.sessionErr = fmt.Errorf("cannot load the session: %v", err)
+		return
+	}
+	if session != nil {
+		c.setSessionCookies(session.Cookies)
+	}
+}
+
+// saveSession stores the cookies in the jar after a successful login
+func (c *Client) saveSession() error {
+	store := c.Config.SessionStore
+	if store == nil {
+		return nil
+	}
+	session := &Session{BaseURL: c.Config.BaseURL, User: c.Config.User, SavedAt: time.Now().UTC(),
+		Cookies: c.sessionCookies()}
+	if err := store.Save(c.sessionKey(), session); err != nil {
+		return fmt.Errorf("cannot save the session: %v", err)
+	}
+	return nil
+}
+
+// SessionError tells why the session could not be loaded from or saved to
+// Config.SessionStore the last time it was tried, which doesn't keep the
+// Client from logging in, but does from reusing the session in the next
+// runs
+func (c *Client) SessionError() error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.sessionErr
+}
@@ -0,0 +1,153 @@
+package bugzilla_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+func makeSessionClient(url string, store bugzilla.SessionStore) *bugzilla.Client {
+	config := bugzilla.Config{BaseURL: url, User: "me", Password: "letmein",
+		FormLogin: true, SessionStore: store}
+	bz, _ := bugzilla.New(config)
+	return bz
+}
+
+func (cs *clientSuite) TestSessionReused(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	store := &bugzilla.FileSessionStore{Dir: filepath.Join(c.MkDir(), "sessions")}
+	bz := makeSessionClient(ts0.URL, store)
+	_, err := bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 1)
+
+	files, err := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+	info, err := os.Stat(files[0])
+	c.Assert(err, IsNil)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0600))
+	info, err = os.Stat(store.Dir)
+	c.Assert(err, IsNil)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0700))
+
+	// a new client, as in another process run
+	bz = makeSessionClient(ts0.URL, store)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	_, err = bz.Update(1047068, bugzilla.Changes{AddComment: "comment"})
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 1)
+
+	// the stored session expired
+	ls.sessions = make(map[string]bool)
+	bz = makeSessionClient(ts0.URL, store)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 2)
+
+	session, err := store.Load(ts0.URL + "\x00me")
+	c.Assert(err, IsNil)
+	c.Assert(session, NotNil)
+	c.Check(session.User, Equals, "me")
+	found := false
+	for _, cookie := range session.Cookies {
+		if cookie.Name == "Bugzilla_logincookie" {
+			c.Check(cookie.Value, Equals, "session2")
+			found = true
+		}
+	}
+	c.Check(found, Equals, true)
+}
+
+func (cs *clientSuite) TestSessionStoreRefusesOpenPermissions(c *C) {
+	store := &bugzilla.FileSessionStore{Dir: c.MkDir()}
+	err := store.Save("key", &bugzilla.Session{User: "me"})
+	c.Assert(err, IsNil)
+	session, err := store.Load("key")
+	c.Assert(err, IsNil)
+	c.Check(session.User, Equals, "me")
+
+	files, _ := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	c.Assert(files, HasLen, 1)
+	c.Assert(os.Chmod(files[0], 0644), IsNil)
+	_, err = store.Load("key")
+	c.Check(err, ErrorMatches, ".*accessible by other users.*")
+
+	session, err = store.Load("another key")
+	c.Check(err, IsNil)
+	c.Check(session, IsNil)
+
+	c.Assert(ioutil.WriteFile(files[0], []byte("garbage"), 0600), IsNil)
+	c.Assert(os.Chmod(files[0], 0600), IsNil)
+	_, err = store.Load("key")
+	c.Check(err, ErrorMatches, ".*failed to decode.*")
+}
+
+func (cs *clientSuite) TestSessionStoreDefault(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	// point os.UserCacheDir() to a temporary directory, whatever the OS
+	home := c.MkDir()
+	for name, value := range map[string]string{"HOME": home, "XDG_CACHE_HOME": filepath.Join(home, ".cache"),
+		"LocalAppData": filepath.Join(home, "AppData")} {
+		saved, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		defer func(name, saved string, ok bool) {
+			if ok {
+				os.Setenv(name, saved)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, saved, ok)
+	}
+	cache, err := os.UserCacheDir()
+	c.Assert(err, IsNil)
+	if !strings.HasPrefix(cache, home) {
+		c.Skip("the cache directory is not taken from the environment on this OS")
+	}
+
+	bz := makeSessionClient(ts0.URL, nil)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(bz.SessionError(), IsNil)
+
+	dir := filepath.Join(cache, "go-suseapi", "sessions")
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	c.Assert(err, IsNil)
+	c.Check(files, HasLen, 1)
+
+	bz = makeSessionClient(ts0.URL, nil)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(ls.logins, Equals, 1)
+}
+
+func (cs *clientSuite) TestSessionStoreErrors(c *C) {
+	ls := &loginServer{c: c, sessions: make(map[string]bool)}
+	ts0 := httptest.NewServer(http.HandlerFunc(ls.handle))
+	defer ts0.Close()
+
+	// the directory can't be created where a file is
+	notDir := filepath.Join(c.MkDir(), "file")
+	err := ioutil.WriteFile(notDir, nil, 0600)
+	c.Assert(err, IsNil)
+	store := &bugzilla.FileSessionStore{Dir: notDir}
+
+	bz := makeSessionClient(ts0.URL, store)
+	_, err = bz.GetBug(1047068)
+	c.Assert(err, IsNil)
+	c.Check(bz.SessionError(), ErrorMatches, "cannot save the session: .*")
+	c.Check(ls.logins, Equals, 1)
+}
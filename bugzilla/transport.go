@@ -0,0 +1,108 @@
+package bugzilla
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TLSConfig has the TLS options used when Config.Transport is not set.
+// CAFile is a PEM bundle trusted in addition to the system roots, CertFile
+// and KeyFile are the PEM client certificate and its key. MinVersion is
+// one of the tls.VersionTLS* constants.
+type TLSConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	MinVersion uint16
+}
+
+func (t *TLSConfig) isZero() bool {
+	return *t == TLSConfig{}
+}
+
+func (t *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: t.MinVersion}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// transport builds the RoundTripper shared by all the requests. An explicit
+// Transport (or the one of HTTPClient) is used as is, otherwise a copy of
+// http.DefaultTransport gets the TLS, proxy and dial options.
+func (config *Config) transport() (http.RoundTripper, error) {
+	custom := config.Transport
+	if custom == nil && config.HTTPClient != nil {
+		custom = config.HTTPClient.Transport
+	}
+	if custom != nil {
+		if !config.TLS.isZero() || config.ProxyURL != "" || config.DialTimeout != 0 {
+			return nil, fmt.Errorf("TLS, ProxyURL and DialTimeout cannot be used with a custom transport")
+		}
+		return custom, nil
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if !config.TLS.isZero() {
+		tlsConfig, err := config.TLS.build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration: %v", err)
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %s", redactURL(config.ProxyURL))
+		}
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+	if config.DialTimeout != 0 {
+		dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: 30 * time.Second}
+		tr.DialContext = dialer.DialContext
+		tr.TLSHandshakeTimeout = config.DialTimeout
+	}
+	return tr, nil
+}
+
+// timeout is the limit of each whole request
+func (config *Config) timeout() time.Duration {
+	if config.Timeout == 0 && config.HTTPClient != nil {
+		return config.HTTPClient.Timeout
+	}
+	return config.Timeout
+}
+
+// redactURL hides the password of the user info of a URL, as in proxy URLs
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return parsed.Redacted()
+}
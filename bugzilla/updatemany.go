@@ -0,0 +1,209 @@
+package bugzilla
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxConcurrentUpdates limits the Update() calls done at once by
+// UpdateMany() when the mass-change form can't be used
+const maxConcurrentUpdates = 4
+
+// BugUpdate is the outcome of UpdateMany() for one bug
+type BugUpdate struct {
+	ID     int
+	Result *UpdateResult
+	Err    error
+}
+
+// massChangeable tells whether all the changes can be done with the
+// mass-change form of buglist.cgi, which has no needinfo, description or
+// time tracking fields and can't check for mid-air collisions
+func (changes *Changes) massChangeable() bool {
+	massChanges := Changes{
+		AddComment:    changes.AddComment,
+		SetURL:        changes.SetURL,
+		SetAssignee:   changes.SetAssignee,
+		SetPriority:   changes.SetPriority,
+		SetWhiteboard: changes.SetWhiteboard,
+		SetStatus:     changes.SetStatus,
+		SetResolution: changes.SetResolution,
+		SetSeverity:   changes.SetSeverity,
+		SetQAContact:  changes.SetQAContact,
+		SetPlatform:   changes.SetPlatform,
+		SetOpSys:      changes.SetOpSys,
+		SetVersion:    changes.SetVersion,
+		AddCc:         changes.AddCc,
+		RemoveCc:      changes.RemoveCc,
+	}
+	if changes.AddCc != "" && changes.RemoveCc != "" {
+		return false
+	}
+	return *changes == massChanges
+}
+
+// setMassChanges sets changes in the mass-change form, where all the
+// fields start with the value "--do_not_change--"
+func (c *Client) setMassChanges(form *htmlForm, changes *Changes) error {
+	if changes.AddComment != "" {
+		form.Set("comment", changes.AddComment)
+	}
+	texts := []struct{ name, value string }{
+		{"bug_file_loc", changes.SetURL},
+		{"assigned_to", changes.SetAssignee},
+		{"qa_contact", changes.SetQAContact},
+		{"status_whiteboard", changes.SetWhiteboard},
+	}
+	for _, text := range texts {
+		if text.value != "" {
+			form.Set(text.name, text.value)
+		}
+	}
+	if changes.SetPriority != "" {
+		prio, ok := c.priorityMap()[changes.SetPriority]
+		if !ok {
+			return InvalidValueError{"priority", changes.SetPriority}
+		}
+		if err := setSelect(form, "priority", prio); err != nil {
+			return err
+		}
+	}
+	selects := []struct{ name, value string }{
+		{"bug_status", changes.SetStatus},
+		{"resolution", changes.SetResolution},
+		{"bug_severity", changes.SetSeverity},
+		{"rep_platform", changes.SetPlatform},
+		{"op_sys", changes.SetOpSys},
+		{"version", changes.SetVersion},
+	}
+	for _, sel := range selects {
+		if sel.value == "" {
+			continue
+		}
+		if err := setSelect(form, sel.name, sel.value); err != nil {
+			return err
+		}
+	}
+	if changes.AddCc != "" {
+		form.Set("masscc", changes.AddCc)
+		form.Set("ccaction", "add")
+	} else if changes.RemoveCc != "" {
+		form.Set("masscc", changes.RemoveCc)
+		form.Set("ccaction", "remove")
+	}
+	return nil
+}
+
+// errNoMassChange tells that the mass-change form can't be used for some
+// bugs and changes: it is not offered to the user, or lacks a field or a
+// value. The bug forms are used instead.
+var errNoMassChange = errors.New("the mass-change form can't be used")
+
+// massUpdate changes all the bugs with a single post of the mass-change
+// form. It fails with errNoMassChange when the form can't be used for these
+// bugs and changes.
+func (c *Client) massUpdate(ids []int, changes *Changes) ([]BugUpdate, error) {
+	url, err := c.getURL("buglist.cgi", map[string]string{"bug_id": joinInts(ids, ","), "tweak": "1"})
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.openPage(url)
+	if err != nil {
+		return nil, err
+	}
+	form, err := p.form("form[name=changeform]")
+	if err != nil {
+		return nil, errNoMassChange
+	}
+	if err = c.setMassChanges(form, changes); err != nil {
+		return nil, errNoMassChange
+	}
+
+	updates := make([]BugUpdate, len(ids))
+	inForm := make(map[int]bool)
+	for i, id := range ids {
+		updates[i].ID = id
+		if err := form.Check(fmt.Sprintf("id_%d", id)); err != nil {
+			updates[i].Err = ErrBugzilla{fmt.Errorf("bug %d is not in the mass-change form", id)}
+			continue
+		}
+		inForm[id] = true
+	}
+	if len(inForm) == 0 {
+		return updates, nil
+	}
+
+	answer, err := c.submit(form)
+	if err == nil {
+		err = c.inspectBugzillaResponse(answer)
+	}
+	for i := range updates {
+		id := updates[i].ID
+		switch {
+		case !inForm[id]:
+		case err != nil:
+			updates[i].Err = err
+		default:
+			updates[i].Result, updates[i].Err = massUpdateResult(answer, id, inForm)
+		}
+	}
+	return updates, nil
+}
+
+func massUpdateResult(answer *page, id int, changed map[int]bool) (*UpdateResult, error) {
+	result, found := parseUpdateResult(answer, id)
+	if !found {
+		return nil, ErrBugzilla{fmt.Errorf("Bugzilla didn't confirm the changes to bug %d", id)}
+	}
+	others := []int{}
+	for _, other := range result.OtherBugs {
+		if !changed[other] {
+			others = append(others, other)
+		}
+	}
+	result.OtherBugs = others
+	return result, nil
+}
+
+// UpdateMany applies the same changes to several bugs. When all the
+// changes are supported by the mass-change form of Bugzilla, all the bugs
+// are changed in a single request, otherwise Update() is called for each
+// bug, a few at a time. There is one BugUpdate for each of ids, in the
+// same order. The error is only set when nothing could be sent, as when
+// the mass-change form could not be loaded; the bug forms are only used
+// instead when the mass-change form can't do the changes.
+func (c *Client) UpdateMany(ids []int, changes Changes) ([]BugUpdate, error) {
+	if len(ids) == 0 {
+		return []BugUpdate{}, nil
+	}
+	if configuration := c.loadedConfiguration(); configuration != nil {
+		if err := configuration.validate(&changes, ""); err != nil {
+			return nil, err
+		}
+	}
+	// status changes are checked against the workflow bug by bug
+	checkWorkflow := c.loadedWorkflow() != nil && (changes.SetStatus != "" || changes.SetResolution != "")
+	if changes.massChangeable() && !checkWorkflow {
+		updates, err := c.massUpdate(ids, &changes)
+		if err != errNoMassChange {
+			return updates, err
+		}
+	}
+
+	updates := make([]BugUpdate, len(ids))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentUpdates)
+	for i, id := range ids {
+		wg.Add(1)
+		go func(update *BugUpdate, id int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			update.ID = id
+			update.Result, update.Err = c.Update(id, changes)
+		}(&updates[i], id)
+	}
+	wg.Wait()
+	return updates, nil
+}
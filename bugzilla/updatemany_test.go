@@ -0,0 +1,210 @@
+package bugzilla_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const massChangeForm = `<html><head><title>Bug List</title></head><body>
+<form name="changeform" method="post" action="process_bug.cgi">
+<table class="bz_buglist">
+  <tr><td><input type="checkbox" name="id_1001" id="id_1001"></td><td>first</td></tr>
+  <tr><td><input type="checkbox" name="id_1002" id="id_1002"></td><td>second</td></tr>
+</table>
+<input type="hidden" name="token" value="1554072294-mass-token">
+<select id="bug_severity" name="bug_severity">
+  <option value="--do_not_change--" selected>--do_not_change--</option>
+  <option value="Critical">Critical</option>
+  <option value="Normal">Normal</option>
+</select>
+<select id="priority" name="priority">
+  <option value="--do_not_change--" selected>--do_not_change--</option>
+  <option value="P1 - Urgent">P1 - Urgent</option>
+  <option value="P3 - Medium">P3 - Medium</option>
+</select>
+<input id="assigned_to" name="assigned_to" value="--do_not_change--">
+<input id="status_whiteboard" name="status_whiteboard" value="--do_not_change--">
+<input id="masscc" name="masscc" value="">
+<select id="ccaction" name="ccaction">
+  <option value="add">Add these to the CC List</option>
+  <option value="remove">Remove these from the CC List</option>
+</select>
+<textarea name="comment" id="comment"></textarea>
+<input type="submit" id="commit" value="Commit">
+</form>
+</body></html>`
+
+func massChangesSubmitted(ids ...string) string {
+	var entries []string
+	for _, id := range ids {
+		entries = append(entries, fmt.Sprintf(`<dl>
+  <dt>Changes submitted for <a class="bz_bug_link" href="show_bug.cgi?id=%s">bug %s</a></dt>
+  <dd><dl><dt>Email sent to:</dt>
+  <dd>
+        <code>owner%s@foobar.com</code>
+  </dd>
+</dl></dd>
+</dl>`, id, id, id))
+	}
+	return "<html><head><title>Bugs processed</title></head><body>" +
+		strings.Join(entries, "\n") + "</body></html>"
+}
+
+// massServer offers the mass-change form, unless noMassForm is set, and
+// fails the searches with listError
+type massServer struct {
+	mu         sync.Mutex
+	noMassForm bool
+	listError  bool
+	lists      int
+	posts      []url.Values
+	forms      int
+	confirmed  []string
+}
+
+func (ms *massServer) handle(w http.ResponseWriter, r *http.Request) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	switch r.URL.Path {
+	case "/buglist.cgi":
+		ms.lists++
+		switch {
+		case ms.listError:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case ms.noMassForm:
+			io.WriteString(w, "<html><body><table class=\"bz_buglist\"></table></body></html>")
+		default:
+			io.WriteString(w, massChangeForm)
+		}
+	case "/show_bug.cgi":
+		ms.forms++
+		io.WriteString(w, showBugHtml)
+	case "/process_bug.cgi":
+		r.ParseForm()
+		ms.posts = append(ms.posts, r.PostForm)
+		if r.PostForm.Get("id") != "" {
+			io.WriteString(w, changesSubmitted)
+			return
+		}
+		var ids []string
+		for name := range r.PostForm {
+			if strings.HasPrefix(name, "id_") {
+				ids = append(ids, name[len("id_"):])
+			}
+		}
+		io.WriteString(w, massChangesSubmitted(append(ids, ms.confirmed...)...))
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestUpdateManyMassChange(c *C) {
+	ms := &massServer{confirmed: []string{"2000"}}
+	ts0 := httptest.NewServer(http.HandlerFunc(ms.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	updates, err := bz.UpdateMany([]int{1001, 1002, 1003}, bugzilla.Changes{
+		AddComment: "moved to the new component", SetSeverity: "Critical",
+		SetPriority: "P1", AddCc: "team@foobar.com"})
+	c.Assert(err, IsNil)
+	c.Check(ms.lists, Equals, 1)
+	c.Check(ms.forms, Equals, 0)
+	c.Assert(ms.posts, HasLen, 1)
+
+	post := ms.posts[0]
+	c.Check(post.Get("id_1001"), Equals, "on")
+	c.Check(post.Get("id_1002"), Equals, "on")
+	c.Check(post.Get("token"), Equals, "1554072294-mass-token")
+	c.Check(post.Get("bug_severity"), Equals, "Critical")
+	c.Check(post.Get("priority"), Equals, "P1 - Urgent")
+	c.Check(post.Get("assigned_to"), Equals, "--do_not_change--")
+	c.Check(post.Get("status_whiteboard"), Equals, "--do_not_change--")
+	c.Check(post.Get("masscc"), Equals, "team@foobar.com")
+	c.Check(post.Get("ccaction"), Equals, "add")
+	c.Check(post.Get("comment"), Equals, "moved to the new component")
+
+	c.Assert(updates, HasLen, 3)
+	for i, id := range []int{1001, 1002} {
+		c.Check(updates[i].ID, Equals, id)
+		c.Assert(updates[i].Err, IsNil)
+		c.Check(updates[i].Result.Recipients, DeepEquals, []string{fmt.Sprintf("owner%d@foobar.com", id)})
+		c.Check(updates[i].Result.OtherBugs, DeepEquals, []int{2000})
+	}
+	c.Check(updates[2].ID, Equals, 1003)
+	c.Check(updates[2].Result, IsNil)
+	c.Check(updates[2].Err, ErrorMatches, ".*bug 1003 is not in the mass-change form")
+}
+
+func (cs *clientSuite) TestUpdateManyFallback(c *C) {
+	ms := &massServer{}
+	ts0 := httptest.NewServer(http.HandlerFunc(ms.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	ids := []int{1001, 1002, 1003, 1004, 1005, 1006}
+	updates, err := bz.UpdateMany(ids, bugzilla.Changes{
+		AddComment: "please check", SetNeedinfo: "user@foobar.com"})
+	c.Assert(err, IsNil)
+	c.Check(ms.lists, Equals, 0)
+	c.Check(ms.forms, Equals, len(ids))
+	c.Check(ms.posts, HasLen, len(ids))
+	c.Assert(updates, HasLen, len(ids))
+	for i, id := range ids {
+		c.Check(updates[i].ID, Equals, id)
+		c.Check(updates[i].Err, IsNil)
+		c.Check(updates[i].Result, NotNil)
+	}
+	for _, post := range ms.posts {
+		c.Check(post.Get("needinfo_from"), Equals, "user@foobar.com")
+	}
+}
+
+func (cs *clientSuite) TestUpdateManyInvalidMassValue(c *C) {
+	// the mass-change form doesn't offer the value: each bug is tried on
+	// its own form, which has its own options
+	ms := &massServer{}
+	ts0 := httptest.NewServer(http.HandlerFunc(ms.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	updates, err := bz.UpdateMany([]int{1001, 1002}, bugzilla.Changes{SetSeverity: "Major"})
+	c.Assert(err, IsNil)
+	c.Check(ms.lists, Equals, 1)
+	c.Check(ms.forms, Equals, 2)
+	c.Assert(updates, HasLen, 2)
+	c.Check(updates[0].Err, IsNil)
+	c.Check(updates[1].Err, IsNil)
+}
+
+func (cs *clientSuite) TestUpdateManyMassChangeErrors(c *C) {
+	// users who can't mass-change get no form: each bug is changed on
+	// its own
+	ms := &massServer{noMassForm: true}
+	ts0 := httptest.NewServer(http.HandlerFunc(ms.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	updates, err := bz.UpdateMany([]int{1001, 1002}, bugzilla.Changes{SetSeverity: "Critical"})
+	c.Assert(err, IsNil)
+	c.Check(ms.lists, Equals, 1)
+	c.Check(ms.forms, Equals, 2)
+	c.Assert(updates, HasLen, 2)
+	c.Check(updates[0].Err, IsNil)
+
+	// other failures are not hidden behind an Update() of each bug
+	ms.noMassForm, ms.listError = false, true
+	ms.forms = 0
+	updates, err = bz.UpdateMany([]int{1001, 1002}, bugzilla.Changes{SetSeverity: "Critical"})
+	c.Assert(err, ErrorMatches, ".*Unauthorized.*")
+	c.Check(updates, IsNil)
+	c.Check(ms.forms, Equals, 0)
+}
@@ -0,0 +1,239 @@
+package bugzilla
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the time between polls of Watcher.Run()
+const DefaultWatchInterval = 5 * time.Minute
+
+// WatcherOptions selects the bugs followed by a Watcher: the ones found by
+// the saved search named SavedQuery, or the ones in IDs. Name tells apart
+// the checkpoints of different watchers.
+type WatcherOptions struct {
+	Name       string
+	SavedQuery string
+	IDs        []int
+	Interval   time.Duration
+}
+
+type watchedBug struct {
+	Changed     string `json:"changed"`
+	LastComment int    `json:"last_comment"`
+	Bug         *Bug   `json:"bug"`
+}
+
+type watcherCheckpoint struct {
+	LastPoll time.Time           `json:"last_poll"`
+	Bugs     map[int]*watchedBug `json:"bugs"`
+}
+
+// Watcher polls Bugzilla for changes in a set of bugs and turns them into
+// Events. The first poll only records the state of the bugs, as do the
+// polls that find a bug for the first time. After each poll, the state is
+// written as JSON to the Cacher of the Client, so that it can be loaded
+// with LoadCheckpoint() when the program starts again. A Watcher must not
+// be used by multiple goroutines at once.
+type Watcher struct {
+	client     *Client
+	options    WatcherOptions
+	checkpoint watcherCheckpoint
+}
+
+// NewWatcher prepares a Watcher following the bugs selected by options
+func (c *Client) NewWatcher(options WatcherOptions) (*Watcher, error) {
+	if (options.SavedQuery == "") == (len(options.IDs) == 0) {
+		return nil, RequestError{fmt.Errorf("a watcher needs either a saved query or a list of bugs")}
+	}
+	if options.Interval == 0 {
+		options.Interval = DefaultWatchInterval
+	}
+	return &Watcher{client: c, options: options,
+		checkpoint: watcherCheckpoint{Bugs: make(map[int]*watchedBug)}}, nil
+}
+
+// CheckpointID is the id used for the checkpoint in the Cacher
+func (w *Watcher) CheckpointID() string {
+	if w.options.Name == "" {
+		return "watcher"
+	}
+	return "watcher-" + w.options.Name
+}
+
+// LoadCheckpoint restores the state written to the Cacher by a previous
+// Watcher
+func (w *Watcher) LoadCheckpoint(source io.Reader) error {
+	var checkpoint watcherCheckpoint
+	err := json.NewDecoder(source).Decode(&checkpoint)
+	if err != nil {
+		return err
+	}
+	if checkpoint.Bugs == nil {
+		checkpoint.Bugs = make(map[int]*watchedBug)
+	}
+	w.checkpoint = checkpoint
+	return nil
+}
+
+func (w *Watcher) saveCheckpoint() {
+	cacher := w.client.cacher
+	if cacher == nil {
+		return
+	}
+	b, err := json.Marshal(&w.checkpoint)
+	if err == nil {
+		writer := cacher.GetWriter(w.CheckpointID())
+		writer.Write(b)
+		writer.Close()
+	}
+}
+
+// search lists the bugs that may have changed with the time of their last
+// change, as shown by Bugzilla. Only the bugs changed since the last poll
+// are listed when watching IDs, all the bugs matching the saved query
+// otherwise.
+func (w *Watcher) search(now time.Time) (map[int]string, error) {
+	params := make(map[string]string)
+	if w.options.SavedQuery != "" {
+		params["cmdtype"] = "runnamed"
+		params["namedcmd"] = w.options.SavedQuery
+	} else {
+		params["bug_id"] = joinInts(w.options.IDs, ",")
+		if !w.checkpoint.LastPoll.IsZero() {
+			// relative dates avoid dealing with the timezone of the
+			// server, at the cost of listing some unchanged bugs
+			hours := int(now.Sub(w.checkpoint.LastPoll).Hours()) + 1
+			params["chfieldfrom"] = fmt.Sprintf("-%dh", hours)
+			params["chfieldto"] = "Now"
+		}
+	}
+	return w.client.searchBugs(params)
+}
+
+// searchBugs runs a search with the parameters of buglist.cgi, listing the
+// bugs found with the time of their last change
+func (c *Client) searchBugs(params map[string]string) (map[int]string, error) {
+	query := map[string]string{"ctype": "csv", "columnlist": "changeddate"}
+	for key, value := range params {
+		query[key] = value
+	}
+	url, err := c.getURL("buglist.cgi", query)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.getBody(url)
+	if err != nil {
+		return nil, err
+	}
+	return parseChangedCSV(body)
+}
+
+func parseChangedCSV(body []byte) (map[int]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, ErrBugzilla{fmt.Errorf("unexpected search result: %v", err)}
+	}
+	idColumn, changedColumn := -1, -1
+	for i, name := range records[0] {
+		switch name {
+		case "bug_id":
+			idColumn = i
+		case "changeddate":
+			changedColumn = i
+		}
+	}
+	if idColumn < 0 || changedColumn < 0 {
+		return nil, ErrBugzilla{fmt.Errorf("unexpected search result: the bug_id and changeddate columns are missing")}
+	}
+	changed := make(map[int]string)
+	for _, record := range records[1:] {
+		id, err := strconv.Atoi(strings.TrimSpace(record[idColumn]))
+		if err != nil {
+			return nil, ErrBugzilla{fmt.Errorf("unexpected search result: invalid bug id %q", record[idColumn])}
+		}
+		changed[id] = record[changedColumn]
+	}
+	return changed, nil
+}
+
+// Poll checks the bugs once, returning the events found since the
+// previous poll
+func (w *Watcher) Poll() ([]Event, error) {
+	now := time.Now()
+	changed, err := w.search(now)
+	if err != nil {
+		return nil, err
+	}
+
+	bugs := w.checkpoint.Bugs
+	if w.options.SavedQuery != "" {
+		for id := range bugs {
+			if _, ok := changed[id]; !ok {
+				delete(bugs, id)
+			}
+		}
+	}
+	var ids []int
+	for id, when := range changed {
+		if watched, ok := bugs[id]; !ok || watched.Changed != when {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	// bugs that became inaccessible are just not followed anymore
+	fetched, _, err := w.client.getBugsInBatches(ids)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, bug := range fetched {
+		watched, ok := bugs[bug.BugID]
+		if ok && !watched.Bug.DeltaTS.Equal(bug.DeltaTS) {
+			events = append(events, bugEvents(watched.Bug, bug, watched.LastComment)...)
+		}
+		snapshot := *bug
+		snapshot.Comments = nil
+		bugs[bug.BugID] = &watchedBug{Changed: changed[bug.BugID],
+			LastComment: lastCommentID(bug), Bug: &snapshot}
+	}
+
+	w.checkpoint.LastPoll = now
+	w.saveCheckpoint()
+	return events, nil
+}
+
+// Run polls for changes every Interval, sending the events to events. It
+// returns when ctx is done or a poll fails; the checkpoint allows starting
+// again from there.
+func (w *Watcher) Run(ctx context.Context, events chan<- Event) error {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+	for {
+		found, err := w.Poll()
+		if err != nil {
+			return err
+		}
+		for _, event := range found {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
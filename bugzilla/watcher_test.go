@@ -0,0 +1,223 @@
+package bugzilla_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+type watchBug struct {
+	changed     int
+	status      string
+	resolution  string
+	whiteboard  string
+	needinfo    string
+	comments    int
+	attachments int
+}
+
+func (b *watchBug) xml(id int) string {
+	xml := fmt.Sprintf(`<bug><bug_id>%d</bug_id><short_desc>Bug %d</short_desc>
+<delta_ts>2019-03-27 10:%02d:00 +0000</delta_ts>
+<bug_status>%s</bug_status><resolution>%s</resolution>
+<status_whiteboard>%s</status_whiteboard>
+<assigned_to name="Firstname Lastname">user@foobar.com</assigned_to>`,
+		id, id, b.changed, b.status, b.resolution, b.whiteboard)
+	if b.needinfo != "" {
+		xml += fmt.Sprintf(`<flag name="needinfo" id="700" type_id="4" status="?" setter="user@foobar.com" requestee="%s"/>`, b.needinfo)
+	}
+	for i := 1; i <= b.attachments; i++ {
+		xml += fmt.Sprintf(`<attachment isobsolete="0" ispatch="0" isprivate="0">
+<attachid>%d</attachid><date>2019-03-27 10:%02d:00 +0000</date><desc>log %d</desc>
+<attacher name="Other">other@foobar.com</attacher></attachment>`, id*10+i, b.changed, i)
+	}
+	for i := 0; i < b.comments; i++ {
+		xml += fmt.Sprintf(`<long_desc isprivate="0"><commentid>%d</commentid><comment_count>%d</comment_count>
+<who name="Other">other@foobar.com</who><bug_when>2019-03-27 10:%02d:00 +0000</bug_when>
+<thetext>comment %d</thetext></long_desc>`, id*100+i, i, b.changed, i)
+	}
+	return xml + "</bug>"
+}
+
+type watchServer struct {
+	mu       sync.Mutex
+	bugs     map[int]*watchBug
+	searches []url.Values
+	fetched  [][]string
+}
+
+func (ws *watchServer) handle(w http.ResponseWriter, r *http.Request) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case "/buglist.cgi":
+		ws.searches = append(ws.searches, query)
+		io.WriteString(w, "bug_id,\"changeddate\"\n")
+		var wanted []string
+		if query.Get("cmdtype") == "runnamed" {
+			for id := range ws.bugs {
+				wanted = append(wanted, strconv.Itoa(id))
+			}
+		} else {
+			wanted = strings.Split(query.Get("bug_id"), ",")
+		}
+		for _, raw := range wanted {
+			id, _ := strconv.Atoi(raw)
+			if bug, ok := ws.bugs[id]; ok {
+				fmt.Fprintf(w, "%d,\"2019-03-27 10:%02d:00\"\n", id, bug.changed)
+			}
+		}
+	case "/show_bug.cgi":
+		ws.fetched = append(ws.fetched, query["id"])
+		io.WriteString(w, `<?xml version="1.0"?><bugzilla version="4.4.12">`)
+		for _, raw := range query["id"] {
+			id, _ := strconv.Atoi(raw)
+			io.WriteString(w, ws.bugs[id].xml(id))
+		}
+		io.WriteString(w, "</bugzilla>")
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+type multiCacher struct {
+	bufs map[string]*FakeBuf
+}
+
+func (m *multiCacher) GetWriter(id string) io.WriteCloser {
+	m.bufs[id] = &FakeBuf{}
+	return m.bufs[id]
+}
+
+func eventSummaries(events []bugzilla.Event) []string {
+	var summaries []string
+	for _, event := range events {
+		summaries = append(summaries, event.String())
+	}
+	return summaries
+}
+
+func (cs *clientSuite) TestWatcherEvents(c *C) {
+	ws := &watchServer{bugs: map[int]*watchBug{
+		1: {changed: 1, status: "NEW", comments: 1},
+		2: {changed: 1, status: "NEW", comments: 1},
+	}}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	cacher := &multiCacher{bufs: make(map[string]*FakeBuf)}
+	bz := makeClientWithCache(ts0.URL, cacher)
+	watcher, err := bz.NewWatcher(bugzilla.WatcherOptions{IDs: []int{1, 2}})
+	c.Assert(err, IsNil)
+
+	events, err := watcher.Poll()
+	c.Assert(err, IsNil)
+	c.Check(events, HasLen, 0)
+	c.Check(ws.fetched, DeepEquals, [][]string{{"1", "2"}})
+	c.Check(ws.searches[0].Get("chfieldfrom"), Equals, "")
+
+	ws.bugs[1] = &watchBug{changed: 2, status: "RESOLVED", resolution: "FIXED",
+		whiteboard: "wasL3:1", needinfo: "me@foobar.com", comments: 2, attachments: 1}
+	events, err = watcher.Poll()
+	c.Assert(err, IsNil)
+	c.Check(ws.fetched[1], DeepEquals, []string{"1"})
+	c.Check(ws.searches[1].Get("chfieldfrom"), Equals, "-1h")
+	c.Check(eventSummaries(events), DeepEquals, []string{
+		`bug 1: bug_status: "NEW" -> "RESOLVED"`,
+		`bug 1: resolution: "" -> "FIXED"`,
+		`bug 1: status_whiteboard: "" -> "wasL3:1"`,
+		`bug 1: needinfo: "" -> "needinfo?(me@foobar.com)"`,
+		`bug 1: attachment 11 (log 1) by other@foobar.com`,
+		`bug 1: comment 1 by other@foobar.com`,
+	})
+	c.Check(events[0].Kind, Equals, bugzilla.EventStatus)
+	c.Check(events[2].Kind, Equals, bugzilla.EventField)
+	c.Check(events[3].Kind, Equals, bugzilla.EventFlag)
+	c.Check(events[3].Flag.Requestee, Equals, "me@foobar.com")
+	c.Check(events[4].Kind, Equals, bugzilla.EventAttachment)
+	c.Check(events[5].Kind, Equals, bugzilla.EventComment)
+	c.Check(events[5].Comment.TheText, Equals, "comment 1")
+	c.Check(events[5].When, Equals, time.Date(2019, 3, 27, 10, 2, 0, 0, time.UTC))
+
+	// a restarted watcher goes on from the checkpoint
+	checkpoint, ok := cacher.bufs[watcher.CheckpointID()]
+	c.Assert(ok, Equals, true)
+	watcher, err = bz.NewWatcher(bugzilla.WatcherOptions{IDs: []int{1, 2}})
+	c.Assert(err, IsNil)
+	c.Assert(watcher.LoadCheckpoint(bytes.NewReader(checkpoint.Bytes())), IsNil)
+
+	ws.bugs[1].changed = 3
+	ws.bugs[1].needinfo = ""
+	ws.bugs[1].comments = 3
+	events, err = watcher.Poll()
+	c.Assert(err, IsNil)
+	c.Check(eventSummaries(events), DeepEquals, []string{
+		`bug 1: needinfo: "needinfo?(me@foobar.com)" -> ""`,
+		`bug 1: comment 2 by other@foobar.com`,
+	})
+	c.Check(ws.fetched[2], DeepEquals, []string{"1"})
+}
+
+func (cs *clientSuite) TestWatcherSavedQuery(c *C) {
+	ws := &watchServer{bugs: map[int]*watchBug{
+		1: {changed: 1, status: "NEW"},
+	}}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	watcher, err := bz.NewWatcher(bugzilla.WatcherOptions{SavedQuery: "My Bugs",
+		Interval: 10 * time.Millisecond})
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan bugzilla.Event)
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx, events)
+	}()
+
+	// change the bugs once the first poll has recorded them
+	for {
+		ws.mu.Lock()
+		if len(ws.fetched) > 0 {
+			ws.bugs[2] = &watchBug{changed: 1, status: "NEW"}
+			ws.bugs[1] = &watchBug{changed: 2, status: "IN_PROGRESS"}
+			ws.mu.Unlock()
+			break
+		}
+		ws.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case event := <-events:
+		c.Check(event.String(), Equals, `bug 1: bug_status: "NEW" -> "IN_PROGRESS"`)
+	case <-time.After(5 * time.Second):
+		c.Fatal("no event received")
+	}
+	cancel()
+	c.Check(<-done, Equals, context.Canceled)
+	c.Check(ws.searches[0].Get("namedcmd"), Equals, "My Bugs")
+	c.Check(ws.searches[0].Get("ctype"), Equals, "csv")
+}
+
+func (cs *clientSuite) TestWatcherOptions(c *C) {
+	bz := makeClient("http://bugzilla.example.com")
+	_, err := bz.NewWatcher(bugzilla.WatcherOptions{})
+	c.Check(err, FitsTypeOf, bugzilla.RequestError{})
+	_, err = bz.NewWatcher(bugzilla.WatcherOptions{SavedQuery: "My Bugs", IDs: []int{1}})
+	c.Check(err, FitsTypeOf, bugzilla.RequestError{})
+}
@@ -0,0 +1,254 @@
+package bugzilla
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default headers checked by Webhook
+const (
+	DefaultWebhookSecretHeader    = "X-Bugzilla-Secret"
+	DefaultWebhookSignatureHeader = "X-Bugzilla-Signature"
+)
+
+// maxWebhookPayload limits the size of the requests read by Webhook
+const maxWebhookPayload = 10 * 1024 * 1024
+
+// WebhookOptions configures a Webhook. Requests are accepted when
+// SignatureHeader has the HMAC-SHA256 of the body with Secret as key, in
+// hex and optionally prefixed with "sha256=", or when SecretHeader has
+// Secret itself. With Enrich, the bug is fetched with GetBug() before
+// calling Callback.
+type WebhookOptions struct {
+	Secret          string
+	SecretHeader    string
+	SignatureHeader string
+	Enrich          bool
+	Callback        func(delivery *WebhookDelivery) error
+}
+
+// WebhookDelivery is a notification received by a Webhook. Action is
+// "create" or "modify" and Target is "bug", "comment" or "attachment", as
+// sent by Bugzilla. Bug is only set with WebhookOptions.Enrich.
+type WebhookDelivery struct {
+	BugID  int
+	Action string
+	Target string
+	Who    string
+	When   time.Time
+	Events []Event
+	Bug    *Bug
+}
+
+type webhookUser struct {
+	Login    string `json:"login"`
+	RealName string `json:"real_name"`
+}
+
+type webhookPayload struct {
+	Event struct {
+		Action  string      `json:"action"`
+		Target  string      `json:"target"`
+		Time    string      `json:"time"`
+		User    webhookUser `json:"user"`
+		Changes []struct {
+			Field   string `json:"field"`
+			Removed string `json:"removed"`
+			Added   string `json:"added"`
+		} `json:"changes"`
+	} `json:"event"`
+	Bug struct {
+		ID int `json:"id"`
+	} `json:"bug"`
+	Comment *struct {
+		ID           int    `json:"id"`
+		Number       int    `json:"number"`
+		Body         string `json:"body"`
+		IsPrivate    bool   `json:"is_private"`
+		CreationTime string `json:"creation_time"`
+	} `json:"comment"`
+	Attachment *struct {
+		ID           int    `json:"id"`
+		FileName     string `json:"file_name"`
+		Description  string `json:"description"`
+		ContentType  string `json:"content_type"`
+		IsPatch      bool   `json:"is_patch"`
+		IsObsolete   bool   `json:"is_obsolete"`
+		IsPrivate    bool   `json:"is_private"`
+		CreationTime string `json:"creation_time"`
+	} `json:"attachment"`
+}
+
+// webhookFields maps the field names of the REST API, used in the
+// payloads, to the names of the fields in the Bugzilla forms
+var webhookFields = map[string]string{
+	"status":      "bug_status",
+	"summary":     "short_desc",
+	"platform":    "rep_platform",
+	"severity":    "bug_severity",
+	"whiteboard":  "status_whiteboard",
+	"url":         "bug_file_loc",
+	"depends_on":  "dependson",
+	"blocks":      "blocked",
+	"flag":        "flagtypes.name",
+	"flags":       "flagtypes.name",
+	"is_obsolete": "isobsolete",
+}
+
+// Webhook is an http.Handler receiving the JSON notifications of the
+// webhook and push extensions of Bugzilla
+type Webhook struct {
+	client  *Client
+	options WebhookOptions
+}
+
+// NewWebhook prepares a Webhook calling options.Callback for each valid
+// notification
+func (c *Client) NewWebhook(options WebhookOptions) (*Webhook, error) {
+	if options.Secret == "" {
+		return nil, RequestError{fmt.Errorf("a webhook needs a secret")}
+	}
+	if options.Callback == nil {
+		return nil, RequestError{fmt.Errorf("a webhook needs a callback")}
+	}
+	if options.SecretHeader == "" {
+		options.SecretHeader = DefaultWebhookSecretHeader
+	}
+	if options.SignatureHeader == "" {
+		options.SignatureHeader = DefaultWebhookSignatureHeader
+	}
+	return &Webhook{client: c, options: options}, nil
+}
+
+// authorized checks the signature of body, or the shared secret when
+// there's no signature
+func (w *Webhook) authorized(r *http.Request, body []byte) bool {
+	if signature := r.Header.Get(w.options.SignatureHeader); signature != "" {
+		expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(w.options.Secret))
+		mac.Write(body)
+		return hmac.Equal(mac.Sum(nil), expected)
+	}
+	secret := r.Header.Get(w.options.SecretHeader)
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(w.options.Secret)) == 1
+}
+
+func parseWebhookTime(raw string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseWebhookPayload decodes a notification into a WebhookDelivery
+func parseWebhookPayload(body []byte) (*WebhookDelivery, error) {
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, RequestError{fmt.Errorf("invalid webhook payload: %v", err)}
+	}
+	if payload.Bug.ID == 0 {
+		return nil, RequestError{fmt.Errorf("invalid webhook payload: no bug id")}
+	}
+	event := payload.Event
+	delivery := &WebhookDelivery{BugID: payload.Bug.ID, Action: event.Action,
+		Target: event.Target, Who: event.User.Login, When: parseWebhookTime(event.Time),
+		Events: []Event{}}
+	base := Event{BugID: delivery.BugID, When: delivery.When, Who: delivery.Who}
+	who := User{Name: event.User.RealName, Email: event.User.Login}
+
+	var attachment *Attachment
+	if a := payload.Attachment; a != nil {
+		attachment = &Attachment{AttachID: a.ID, Filename: a.FileName,
+			Desc: a.Description, Type: a.ContentType, Attacher: who,
+			Date: parseWebhookTime(a.CreationTime)}
+		if a.IsPatch {
+			attachment.IsPatch = 1
+		}
+		if a.IsObsolete {
+			attachment.IsObsolete = 1
+		}
+		if a.IsPrivate {
+			attachment.IsPrivate = 1
+		}
+	}
+
+	for _, change := range event.Changes {
+		field := change.Field
+		if name, ok := webhookFields[field]; ok {
+			field = name
+		}
+		var changed *Attachment
+		if event.Target == "attachment" {
+			changed = attachment
+		}
+		delivery.Events = append(delivery.Events, changeEvents(base, field, change.Removed, change.Added, changed)...)
+	}
+
+	if attachment != nil && event.Target == "attachment" && event.Action == "create" {
+		e := base
+		e.Kind, e.When, e.Attachment = EventAttachment, attachment.Date, attachment
+		delivery.Events = append(delivery.Events, e)
+	}
+	if c := payload.Comment; c != nil && event.Target == "comment" && event.Action == "create" {
+		comment := &Comment{ID: c.ID, Count: c.Number, Who: who,
+			BugWhen: parseWebhookTime(c.CreationTime), TheText: c.Body}
+		if c.IsPrivate {
+			comment.IsPrivate = 1
+		}
+		e := base
+		e.Kind, e.When, e.Comment = EventComment, comment.BugWhen, comment
+		delivery.Events = append(delivery.Events, e)
+	}
+	return delivery, nil
+}
+
+// ServeHTTP validates and decodes a notification, then hands it to the
+// callback. Errors of the callback and of GetBug() are answered with a
+// server error, so that Bugzilla tries again.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(rw, "failed to read the request", http.StatusBadRequest)
+		return
+	}
+	if !w.authorized(r, body) {
+		http.Error(rw, "invalid secret or signature", http.StatusUnauthorized)
+		return
+	}
+	delivery, err := parseWebhookPayload(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if w.options.Enrich {
+		delivery.Bug, err = w.client.GetBug(delivery.BugID)
+		if err != nil {
+			http.Error(rw, "failed to fetch the bug", http.StatusBadGateway)
+			return
+		}
+	}
+	if err = w.options.Callback(delivery); err != nil {
+		http.Error(rw, "failed to handle the notification", http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package bugzilla_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const webhookModify = `{
+  "webhook_name": "bots",
+  "event": {
+    "action": "modify",
+    "target": "bug",
+    "time": "2019-03-27T10:45:20Z",
+    "user": {"id": 2, "login": "other@foobar.com", "real_name": "Other User"},
+    "changes": [
+      {"field": "status", "removed": "NEW", "added": "RESOLVED"},
+      {"field": "resolution", "removed": "", "added": "FIXED"},
+      {"field": "cc", "removed": "", "added": "new@foobar.com"},
+      {"field": "flagtypes.name", "removed": "needinfo?(other@foobar.com)", "added": ""}
+    ]
+  },
+  "bug": {"id": 1047068, "status": "RESOLVED"}
+}`
+
+const webhookComment = `{
+  "event": {
+    "action": "create",
+    "target": "comment",
+    "time": "2019-03-27T10:45:20",
+    "user": {"login": "other@foobar.com", "real_name": "Other User"}
+  },
+  "bug": {"id": 1047068},
+  "comment": {"id": 9000, "number": 5, "body": "Fixed.", "creation_time": "2019-03-27T10:45:20Z"}
+}`
+
+type webhookRecorder struct {
+	deliveries []*bugzilla.WebhookDelivery
+	err        error
+}
+
+func (wr *webhookRecorder) callback(delivery *bugzilla.WebhookDelivery) error {
+	wr.deliveries = append(wr.deliveries, delivery)
+	return wr.err
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(handler http.Handler, body string, headers map[string]string) int {
+	req := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func (cs *clientSuite) TestWebhookEvents(c *C) {
+	recorder := &webhookRecorder{}
+	hook, err := makeClient("http://foobar.com/").NewWebhook(bugzilla.WebhookOptions{
+		Secret: "s3cr3t", Callback: recorder.callback})
+	c.Assert(err, IsNil)
+
+	code := postWebhook(hook, webhookModify, map[string]string{
+		"X-Bugzilla-Signature": sign("s3cr3t", webhookModify)})
+	c.Assert(code, Equals, http.StatusNoContent)
+	code = postWebhook(hook, webhookComment, map[string]string{
+		"X-Bugzilla-Secret": "s3cr3t"})
+	c.Assert(code, Equals, http.StatusNoContent)
+
+	c.Assert(recorder.deliveries, HasLen, 2)
+	delivery := recorder.deliveries[0]
+	c.Assert(delivery.BugID, Equals, 1047068)
+	c.Assert(delivery.Action, Equals, "modify")
+	c.Assert(delivery.Who, Equals, "other@foobar.com")
+	c.Assert(delivery.Bug, IsNil)
+	c.Assert(eventSummaries(delivery.Events), DeepEquals, []string{
+		`bug 1047068: bug_status: "NEW" -> "RESOLVED"`,
+		`bug 1047068: resolution: "" -> "FIXED"`,
+		`bug 1047068: cc: "" -> "new@foobar.com"`,
+		`bug 1047068: needinfo: "needinfo?(other@foobar.com)" -> ""`,
+	})
+	c.Assert(delivery.Events[0].Kind, Equals, bugzilla.EventStatus)
+	c.Assert(delivery.Events[3].Kind, Equals, bugzilla.EventFlag)
+
+	delivery = recorder.deliveries[1]
+	c.Assert(delivery.Target, Equals, "comment")
+	c.Assert(eventSummaries(delivery.Events), DeepEquals, []string{
+		`bug 1047068: comment 5 by other@foobar.com`,
+	})
+	c.Assert(delivery.Events[0].Comment.TheText, Equals, "Fixed.")
+	c.Assert(delivery.Events[0].Comment.Who.Name, Equals, "Other User")
+}
+
+func (cs *clientSuite) TestWebhookRejects(c *C) {
+	recorder := &webhookRecorder{}
+	hook, err := makeClient("http://foobar.com/").NewWebhook(bugzilla.WebhookOptions{
+		Secret: "s3cr3t", Callback: recorder.callback})
+	c.Assert(err, IsNil)
+
+	c.Assert(postWebhook(hook, webhookModify, nil), Equals, http.StatusUnauthorized)
+	c.Assert(postWebhook(hook, webhookModify, map[string]string{
+		"X-Bugzilla-Secret": "guess"}), Equals, http.StatusUnauthorized)
+	c.Assert(postWebhook(hook, webhookModify, map[string]string{
+		"X-Bugzilla-Signature": sign("guess", webhookModify)}), Equals, http.StatusUnauthorized)
+	// a valid secret doesn't make up for a bad signature
+	c.Assert(postWebhook(hook, webhookModify, map[string]string{
+		"X-Bugzilla-Secret": "s3cr3t", "X-Bugzilla-Signature": "sha256=00"}), Equals, http.StatusUnauthorized)
+	c.Assert(postWebhook(hook, "{not json", map[string]string{
+		"X-Bugzilla-Secret": "s3cr3t"}), Equals, http.StatusBadRequest)
+
+	req := httptest.NewRequest("GET", "/hook", nil)
+	rec := httptest.NewRecorder()
+	hook.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(recorder.deliveries, HasLen, 0)
+
+	recorder.err = fmt.Errorf("busy")
+	c.Assert(postWebhook(hook, webhookModify, map[string]string{
+		"X-Bugzilla-Secret": "s3cr3t"}), Equals, http.StatusInternalServerError)
+
+	_, err = makeClient("http://foobar.com/").NewWebhook(bugzilla.WebhookOptions{Callback: recorder.callback})
+	c.Assert(err, ErrorMatches, ".*a webhook needs a secret")
+}
+
+func (cs *clientSuite) TestWebhookEnrich(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(new(bugServer).handle))
+	defer ts.Close()
+
+	recorder := &webhookRecorder{}
+	hook, err := makeClient(ts.URL).NewWebhook(bugzilla.WebhookOptions{
+		Secret: "s3cr3t", SecretHeader: "X-Token", Enrich: true,
+		Callback: recorder.callback})
+	c.Assert(err, IsNil)
+
+	c.Assert(postWebhook(hook, webhookModify, map[string]string{
+		"X-Token": "s3cr3t"}), Equals, http.StatusNoContent)
+	c.Assert(recorder.deliveries, HasLen, 1)
+	c.Assert(recorder.deliveries[0].Bug, NotNil)
+	c.Assert(recorder.deliveries[0].Bug.BugID, Equals, 1047068)
+}
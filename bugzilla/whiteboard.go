@@ -0,0 +1,202 @@
+package bugzilla
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// WhiteboardToken is a whitespace separated token of the status
+// whiteboard. Tokens as "wasL3:48626" have Key "wasL3" and Value "48626",
+// bare ones as "zzz" only have Key.
+type WhiteboardToken struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// ParseWhiteboardToken splits a token at its first colon
+func ParseWhiteboardToken(text string) WhiteboardToken {
+	parts := strings.SplitN(text, ":", 2)
+	token := WhiteboardToken{Key: parts[0]}
+	if len(parts) == 2 {
+		token.Value = parts[1]
+	}
+	return token
+}
+
+func (t WhiteboardToken) String() string {
+	if t.Value == "" {
+		return t.Key
+	}
+	return t.Key + ":" + t.Value
+}
+
+// Whiteboard is the status whiteboard as a bag of tokens. The whitespace
+// between the tokens that were parsed is kept, so that String() only
+// differs from the parsed text where tokens were edited.
+type Whiteboard struct {
+	tokens []string
+	// spaces[i] is the whitespace before tokens[i]
+	spaces []string
+}
+
+// ParseWhiteboard splits the text of the status whiteboard in tokens
+func ParseWhiteboard(text string) *Whiteboard {
+	w := &Whiteboard{}
+	for text != "" {
+		start := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+		if start < 0 {
+			break
+		}
+		end := strings.IndexFunc(text[start:], unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		w.spaces = append(w.spaces, text[:start])
+		w.tokens = append(w.tokens, text[start:end])
+		text = text[end:]
+	}
+	return w
+}
+
+func (w *Whiteboard) String() string {
+	var text strings.Builder
+	for i, token := range w.tokens {
+		if i > 0 {
+			text.WriteString(w.spaces[i])
+		}
+		text.WriteString(token)
+	}
+	return text.String()
+}
+
+// Tokens lists the tokens in the order they appear
+func (w *Whiteboard) Tokens() []WhiteboardToken {
+	tokens := make([]WhiteboardToken, len(w.tokens))
+	for i, token := range w.tokens {
+		tokens[i] = ParseWhiteboardToken(token)
+	}
+	return tokens
+}
+
+// Has tells whether the exact token is in the whiteboard
+func (w *Whiteboard) Has(token string) bool {
+	for _, current := range w.tokens {
+		if current == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Get finds the value of the first token with key
+func (w *Whiteboard) Get(key string) (string, bool) {
+	for _, token := range w.Tokens() {
+		if token.Key == key {
+			return token.Value, true
+		}
+	}
+	return "", false
+}
+
+// Add appends token unless it is already there, and tells whether the
+// whiteboard changed
+func (w *Whiteboard) Add(token string) bool {
+	if token == "" || w.Has(token) {
+		return false
+	}
+	w.tokens = append(w.tokens, token)
+	w.spaces = append(w.spaces, " ")
+	return true
+}
+
+// remove drops the tokens for which match is true
+func (w *Whiteboard) remove(match func(token string) bool) bool {
+	var tokens, spaces []string
+	for i, token := range w.tokens {
+		if !match(token) {
+			tokens = append(tokens, token)
+			spaces = append(spaces, w.spaces[i])
+		}
+	}
+	changed := len(tokens) != len(w.tokens)
+	w.tokens, w.spaces = tokens, spaces
+	return changed
+}
+
+// Remove drops the exact token and tells whether it was there
+func (w *Whiteboard) Remove(token string) bool {
+	return w.remove(func(current string) bool { return current == token })
+}
+
+// RemoveKey drops all the tokens with key, with or without value
+func (w *Whiteboard) RemoveKey(key string) bool {
+	return w.remove(func(current string) bool { return ParseWhiteboardToken(current).Key == key })
+}
+
+// replace puts token in the place of the first token for which match is
+// true, dropping the other matches, or appends it if none matched
+func (w *Whiteboard) replace(match func(token string) bool, token string) bool {
+	first := -1
+	for i, current := range w.tokens {
+		if match(current) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return w.Add(token)
+	}
+	changed := w.tokens[first] != token
+	tokens, spaces := w.tokens[:first+1], w.spaces[:first+1]
+	for i := first + 1; i < len(w.tokens); i++ {
+		if match(w.tokens[i]) {
+			changed = true
+			continue
+		}
+		tokens = append(tokens, w.tokens[i])
+		spaces = append(spaces, w.spaces[i])
+	}
+	tokens[first] = token
+	w.tokens, w.spaces = tokens, spaces
+	return changed
+}
+
+// Set replaces the tokens with key by a single "key:value" one, in the
+// place of the first of them, or appends it if the key is not there
+func (w *Whiteboard) Set(key, value string) bool {
+	token := WhiteboardToken{key, value}.String()
+	return w.replace(func(current string) bool { return ParseWhiteboardToken(current).Key == key }, token)
+}
+
+// setWhiteboardTokens applies the token edits of changes to the
+// status_whiteboard field of form, which has the current whiteboard, or
+// the one of SetWhiteboard
+func setWhiteboardTokens(changes *Changes, form *htmlForm) error {
+	if changes.AddWhiteboardToken == "" && changes.RemoveWhiteboardToken == "" &&
+		changes.RemoveWhiteboardKey == "" && changes.SetWhiteboardToken == "" {
+		return nil
+	}
+	current, ok := form.Value("status_whiteboard")
+	if !ok {
+		return ErrBugzilla{fmt.Errorf("no status_whiteboard field found in the bug form")}
+	}
+	w := ParseWhiteboard(current)
+	for _, token := range strings.Fields(changes.RemoveWhiteboardToken) {
+		w.Remove(token)
+	}
+	for _, key := range strings.Fields(changes.RemoveWhiteboardKey) {
+		w.RemoveKey(key)
+	}
+	for _, text := range strings.Fields(changes.SetWhiteboardToken) {
+		token := ParseWhiteboardToken(text)
+		w.Set(token.Key, token.Value)
+	}
+	for _, token := range strings.Fields(changes.AddWhiteboardToken) {
+		w.Add(token)
+	}
+	form.Set("status_whiteboard", w.String())
+	return nil
+}
@@ -0,0 +1,96 @@
+package bugzilla_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+func (cs *clientSuite) TestParseWhiteboard(c *C) {
+	w := bugzilla.ParseWhiteboard("  wasZZ:48626  zzz\topenZZ:54027 url:http://x/y ")
+	c.Assert(w.Tokens(), DeepEquals, []bugzilla.WhiteboardToken{
+		{Key: "wasZZ", Value: "48626"},
+		{Key: "zzz"},
+		{Key: "openZZ", Value: "54027"},
+		{Key: "url", Value: "http://x/y"},
+	})
+	c.Assert(w.String(), Equals, "wasZZ:48626  zzz\topenZZ:54027 url:http://x/y")
+	c.Assert(w.Has("zzz"), Equals, true)
+	c.Assert(w.Has("wasZZ"), Equals, false)
+	value, ok := w.Get("openZZ")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "54027")
+	_, ok = w.Get("wasL3")
+	c.Assert(ok, Equals, false)
+
+	c.Assert(bugzilla.ParseWhiteboard("").Tokens(), HasLen, 0)
+	c.Assert(bugzilla.ParseWhiteboard(" \t ").String(), Equals, "")
+}
+
+func (cs *clientSuite) TestEditWhiteboard(c *C) {
+	w := bugzilla.ParseWhiteboard("wasZZ:48626  zzz     openZZ:54027")
+	c.Assert(w.Add("zzz"), Equals, false)
+	c.Assert(w.Add("triage:done"), Equals, true)
+	c.Assert(w.String(), Equals, "wasZZ:48626  zzz     openZZ:54027 triage:done")
+
+	c.Assert(w.Remove("zzz"), Equals, true)
+	c.Assert(w.Remove("zzz"), Equals, false)
+	c.Assert(w.String(), Equals, "wasZZ:48626     openZZ:54027 triage:done")
+
+	c.Assert(w.Set("openZZ", "60000"), Equals, true)
+	c.Assert(w.Set("openZZ", "60000"), Equals, false)
+	c.Assert(w.Set("wasL3", "1"), Equals, true)
+	c.Assert(w.String(), Equals, "wasZZ:48626     openZZ:60000 triage:done wasL3:1")
+
+	// the first token of the key is replaced and the others go away
+	w = bugzilla.ParseWhiteboard("a:1 b a:2 c a")
+	c.Assert(w.Set("a", "3"), Equals, true)
+	c.Assert(w.String(), Equals, "a:3 b c")
+
+	c.Assert(w.RemoveKey("a"), Equals, true)
+	c.Assert(w.RemoveKey("a"), Equals, false)
+	c.Assert(w.String(), Equals, "b c")
+}
+
+func (cs *clientSuite) TestUpdateWhiteboardTokens(c *C) {
+	var posts []url.Values
+	formWhiteboard := "wasZZ:48626  zzz     openZZ:54027"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/show_bug.cgi":
+			io.WriteString(w, strings.Replace(showBugHtml, "wasZZ:48626  zzz     openZZ:54027", formWhiteboard, 1))
+		case "/process_bug.cgi":
+			r.ParseForm()
+			posts = append(posts, r.PostForm)
+			io.WriteString(w, changesSubmitted)
+		default:
+			http.Error(w, "Unimplemented", 500)
+		}
+	}))
+	defer ts.Close()
+	bz := makeClient(ts.URL)
+
+	_, err := bz.Update(1047068, bugzilla.Changes{
+		AddWhiteboardToken:    "triage:done frob",
+		RemoveWhiteboardToken: "zzz",
+		SetWhiteboardToken:    "openZZ:60000"})
+	c.Assert(err, IsNil)
+	c.Assert(posts[0].Get("status_whiteboard"), Equals, "wasZZ:48626     openZZ:60000 triage:done frob")
+
+	// the edits apply to the whiteboard of the form, with the tokens
+	// someone else added
+	formWhiteboard = "wasZZ:48626 other:1"
+	_, err = bz.Update(1047068, bugzilla.Changes{RemoveWhiteboardKey: "wasZZ"})
+	c.Assert(err, IsNil)
+	c.Assert(posts[1].Get("status_whiteboard"), Equals, "other:1")
+
+	// and to SetWhiteboard when both are used
+	_, err = bz.Update(1047068, bugzilla.Changes{SetWhiteboard: "new:1", AddWhiteboardToken: "more"})
+	c.Assert(err, IsNil)
+	c.Assert(posts[2].Get("status_whiteboard"), Equals, "new:1 more")
+}
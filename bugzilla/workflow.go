@@ -0,0 +1,303 @@
+package bugzilla
+
+import (
+	"fmt"
+)
+
+// Well-known statuses used by the workflow helpers
+const (
+	StatusResolved = "RESOLVED"
+	StatusVerified = "VERIFIED"
+	StatusReopened = "REOPENED"
+)
+
+// Transition is an allowed change to the status To
+type Transition struct {
+	To              string `json:"name"`
+	CommentRequired bool   `json:"comment_required"`
+}
+
+// Workflow has the statuses of the Bugzilla instance and the transitions
+// allowed between them. Transitions from "" are the ones allowed for new
+// bugs.
+type Workflow struct {
+	Statuses    []string
+	Open        map[string]bool
+	Transitions map[string][]Transition
+}
+
+type fieldValue struct {
+	Name        *string      `json:"name"`
+	IsOpen      bool         `json:"is_open"`
+	CanChangeTo []Transition `json:"can_change_to"`
+}
+
+type fieldsResult struct {
+	Fields []struct {
+		Name   string       `json:"name"`
+		Values []fieldValue `json:"values"`
+	} `json:"fields"`
+}
+
+func newWorkflow(values []fieldValue) *Workflow {
+	workflow := &Workflow{Open: make(map[string]bool), Transitions: make(map[string][]Transition)}
+	for _, value := range values {
+		name := ""
+		if value.Name != nil {
+			name = *value.Name
+			workflow.Statuses = append(workflow.Statuses, name)
+			workflow.Open[name] = value.IsOpen
+		}
+		workflow.Transitions[name] = value.CanChangeTo
+	}
+	return workflow
+}
+
+// GetWorkflow gets the status workflow from the server, using the
+// Bug.fields WebService method. As with GetConfiguration(), the result is
+// kept in the Client and used by Update() to validate status changes.
+func (c *Client) GetWorkflow() (*Workflow, error) {
+	if workflow := c.loadedWorkflow(); workflow != nil {
+		return workflow, nil
+	}
+
+	var result fieldsResult
+	params := map[string][]string{"names": {"bug_status"}}
+	err := c.callJSONRPC("Bug.fields", params, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Fields) == 0 {
+		return nil, ErrBugzilla{fmt.Errorf("the server didn't describe the bug_status field")}
+	}
+
+	workflow := newWorkflow(result.Fields[0].Values)
+	c.mu.Lock()
+	c.workflow = workflow
+	c.mu.Unlock()
+	return workflow, nil
+}
+
+func (c *Client) loadedWorkflow() *Workflow {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.workflow
+}
+
+// IsOpen tells whether status is an open status. Moving a bug to a status
+// that is not open requires a resolution.
+func (w *Workflow) IsOpen(status string) bool {
+	return w.Open[status]
+}
+
+// CanChange finds the transition from a status to another
+func (w *Workflow) CanChange(from, to string) (Transition, bool) {
+	for _, transition := range w.Transitions[from] {
+		if transition.To == to {
+			return transition, true
+		}
+	}
+	return Transition{}, false
+}
+
+// Path computes the shortest list of transitions needed to move a bug from
+// a status to another. The path is empty when both are the same.
+func (w *Workflow) Path(from, to string) ([]Transition, error) {
+	if from == to {
+		return nil, nil
+	}
+
+	type step struct {
+		from       string
+		transition Transition
+	}
+	previous := map[string]step{from: {}}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, transition := range w.Transitions[current] {
+			if _, seen := previous[transition.To]; seen {
+				continue
+			}
+			previous[transition.To] = step{current, transition}
+			if transition.To != to {
+				queue = append(queue, transition.To)
+				continue
+			}
+
+			var path []Transition
+			for status := to; status != from; status = previous[status].from {
+				path = append([]Transition{previous[status].transition}, path...)
+			}
+			return path, nil
+		}
+	}
+	return nil, RequestError{fmt.Errorf("no transition path from %s to %s", from, to)}
+}
+
+// checkTransition validates a status change done by Update() against the
+// workflow
+func (w *Workflow) checkTransition(from string, changes *Changes) error {
+	to := changes.SetStatus
+	if to == "" || to == from {
+		return nil
+	}
+	transition, ok := w.CanChange(from, to)
+	if !ok {
+		return RequestError{fmt.Errorf("cannot change the status from %s to %s", from, to)}
+	}
+	if transition.CommentRequired && changes.AddComment == "" {
+		return RequestError{fmt.Errorf("a comment is required to change the status from %s to %s", from, to)}
+	}
+	if !w.IsOpen(to) && changes.SetResolution == "" && changes.SetDuplicate == 0 {
+		return RequestError{fmt.Errorf("a resolution is required to change the status to %s", to)}
+	}
+	return nil
+}
+
+// pickStatus returns preferred if the bug can be moved to it directly,
+// otherwise the first status reachable from the bug status for which accept
+// returns true
+func (w *Workflow) pickStatus(bug *Bug, preferred string, accept func(string) bool) (string, error) {
+	if _, ok := w.CanChange(bug.BugStatus, preferred); ok {
+		return preferred, nil
+	}
+	for _, transition := range w.Transitions[bug.BugStatus] {
+		if accept(transition.To) {
+			return transition.To, nil
+		}
+	}
+	if _, ok := w.Open[preferred]; ok {
+		return preferred, nil
+	}
+	return "", RequestError{fmt.Errorf("no suitable status found from %s", bug.BugStatus)}
+}
+
+// StatusChangeError is returned when a status change done in several
+// steps fails after some of them were done: the bug was left in Status
+type StatusChangeError struct {
+	BugID  int
+	Status string
+	Err    error
+}
+
+func (e StatusChangeError) Error() string {
+	return fmt.Sprintf("bug %d left in status %s: %v", e.BugID, e.Status, e.Err)
+}
+
+// moveTo walks the bug through all the transitions needed to reach the
+// status picked by target. The comment is added to the last step and to
+// the steps that require one; the resolution is set on the steps that
+// close the bug. The whole path is checked before the first change, and
+// each step is checked for mid-air collisions against the timestamp left
+// by the previous one.
+func (c *Client) moveTo(id int, target func(*Workflow, *Bug) (string, error), resolution, comment string) error {
+	workflow, err := c.GetWorkflow()
+	if err != nil {
+		return err
+	}
+	bug, err := c.GetBug(id)
+	if err != nil {
+		return err
+	}
+
+	to, err := target(workflow, bug)
+	if err != nil {
+		return err
+	}
+	path, err := workflow.Path(bug.BugStatus, to)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		if resolution == "" || resolution == bug.Resolution {
+			return nil
+		}
+		_, err := c.Update(id, Changes{SetResolution: resolution, AddComment: comment,
+			DeltaTS: bug.DeltaTS, CheckDeltaTS: true})
+		return err
+	}
+	if resolution == "" {
+		resolution = bug.Resolution
+	}
+	for _, transition := range path {
+		if transition.CommentRequired && comment == "" {
+			return RequestError{fmt.Errorf("a comment is required to change the status to %s", transition.To)}
+		}
+		if !workflow.IsOpen(transition.To) && resolution == "" {
+			return RequestError{fmt.Errorf("a resolution is required to change the status to %s", transition.To)}
+		}
+	}
+
+	deltaTS := bug.DeltaTS
+	for i, transition := range path {
+		changes := Changes{SetStatus: transition.To, DeltaTS: deltaTS, CheckDeltaTS: true}
+		if transition.CommentRequired || i == len(path)-1 {
+			changes.AddComment = comment
+		}
+		if !workflow.IsOpen(transition.To) {
+			changes.SetResolution = resolution
+		}
+		// the timestamp is needed to check the next step
+		changes.RefreshBug = i < len(path)-1
+		result, err := c.Update(id, changes)
+		if err != nil {
+			if i == 0 {
+				return err
+			}
+			return StatusChangeError{BugID: id, Status: path[i-1].To, Err: err}
+		}
+		deltaTS = result.DeltaTS
+	}
+	return nil
+}
+
+// Resolve closes a bug with the given resolution, going through
+// intermediate statuses when needed. The steps are checked against the
+// workflow before changing anything, and each one fails if someone else
+// changed the bug in the meantime. When a step fails after others were
+// done the error is a StatusChangeError, with the status the bug was left
+// in.
+func (c *Client) Resolve(id int, resolution, comment string) error {
+	if resolution == "" {
+		return RequestError{fmt.Errorf("a resolution is required")}
+	}
+	target := func(w *Workflow, bug *Bug) (string, error) {
+		if !w.IsOpen(bug.BugStatus) {
+			return bug.BugStatus, nil
+		}
+		if _, ok := w.Open[StatusResolved]; ok {
+			return StatusResolved, nil
+		}
+		for _, status := range w.Statuses {
+			if !w.IsOpen(status) {
+				return status, nil
+			}
+		}
+		return "", RequestError{fmt.Errorf("no closed status found in the workflow")}
+	}
+	return c.moveTo(id, target, resolution, comment)
+}
+
+// Reopen moves a closed bug back to an open status, preferably REOPENED.
+// Bugs that are already open are left untouched. As with Resolve(), a
+// failure half way through the steps is a StatusChangeError.
+func (c *Client) Reopen(id int, comment string) error {
+	target := func(w *Workflow, bug *Bug) (string, error) {
+		if w.IsOpen(bug.BugStatus) {
+			return bug.BugStatus, nil
+		}
+		return w.pickStatus(bug, StatusReopened, w.IsOpen)
+	}
+	return c.moveTo(id, target, "", comment)
+}
+
+// Verify marks a resolved bug as verified. As with Resolve(), a failure
+// half way through the steps is a StatusChangeError.
+func (c *Client) Verify(id int) error {
+	target := func(w *Workflow, bug *Bug) (string, error) {
+		return StatusVerified, nil
+	}
+	return c.moveTo(id, target, "", "")
+}
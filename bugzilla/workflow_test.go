@@ -0,0 +1,239 @@
+package bugzilla_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beninidavide/go-suseapi/bugzilla"
+	. "gopkg.in/check.v1"
+)
+
+const bugFieldsJSON = `{"result": {"fields": [{"name": "bug_status", "values": [
+  {"name": null, "is_open": false, "can_change_to": [{"name": "NEW", "comment_required": false}]},
+  {"name": "NEW", "is_open": true, "can_change_to": [
+    {"name": "IN_PROGRESS", "comment_required": false}]},
+  {"name": "IN_PROGRESS", "is_open": true, "can_change_to": [
+    {"name": "NEW", "comment_required": false},
+    {"name": "RESOLVED", "comment_required": true}]},
+  {"name": "REOPENED", "is_open": true, "can_change_to": [
+    {"name": "IN_PROGRESS", "comment_required": false},
+    {"name": "RESOLVED", "comment_required": false}]},
+  {"name": "RESOLVED", "is_open": false, "can_change_to": [
+    {"name": "REOPENED", "comment_required": true},
+    {"name": "VERIFIED", "comment_required": false}]},
+  {"name": "VERIFIED", "is_open": false, "can_change_to": [
+    {"name": "REOPENED", "comment_required": true}]}
+]}]}, "error": null, "id": 1}`
+
+var workflowStatuses = []string{"NEW", "IN_PROGRESS", "REOPENED", "RESOLVED", "VERIFIED"}
+
+// workflowForm builds a minimal changeform for a bug in the given status
+func workflowForm(status, resolution, deltaTS string) string {
+	options := ""
+	for _, s := range workflowStatuses {
+		selected := ""
+		if s == status {
+			selected = ` selected="selected"`
+		}
+		options += fmt.Sprintf(`<option value="%s"%s>%s</option>`, s, selected, s)
+	}
+	return fmt.Sprintf(`<html><body>
+<form name="changeform" id="changeform" method="post" action="process_bug.cgi">
+  <input type="hidden" name="delta_ts" value="%s">
+  <select id="bug_status" name="bug_status">%s</select>
+  <select id="resolution" name="resolution">
+    <option value="FIXED">FIXED</option>
+    <option value="INVALID">INVALID</option>
+  </select>
+  <textarea name="comment" id="comment"></textarea>
+</form>
+</body></html>`, deltaTS, options)
+}
+
+// workflowServer has a bug that changes status and timestamp with each
+// change submitted. After otherChangeAfter changes someone else changes
+// the bug too, before the next form is loaded.
+type workflowServer struct {
+	status           string
+	resolution       string
+	changes          int
+	otherChangeAfter int
+	otherChanged     bool
+	queries          []url.Values
+}
+
+func (ws *workflowServer) deltaTS() string {
+	return time.Date(2019, 3, 28, 11, 40+ws.changes, 39, 0, time.UTC).Format("2006-01-02 15:04:05")
+}
+
+func (ws *workflowServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/jsonrpc.cgi":
+		var call struct {
+			Method string
+			Params []struct{ Names []string }
+		}
+		json.NewDecoder(r.Body).Decode(&call)
+		if call.Method != "Bug.fields" || len(call.Params) != 1 || call.Params[0].Names[0] != "bug_status" {
+			http.Error(w, "Unexpected call", 500)
+			return
+		}
+		io.WriteString(w, bugFieldsJSON)
+	case "/show_bug.cgi":
+		if r.URL.Query().Get("ctype") == "xml" {
+			xml := strings.Replace(bugXml, "<bug_status>RESOLVED</bug_status>",
+				"<bug_status>"+ws.status+"</bug_status>", 1)
+			xml = strings.Replace(xml, "<resolution>FIXED</resolution>",
+				"<resolution>"+ws.resolution+"</resolution>", 1)
+			xml = strings.Replace(xml, "2019-03-27 10:45:20", ws.deltaTS(), 1)
+			io.WriteString(w, xml)
+			return
+		}
+		if ws.otherChangeAfter > 0 && len(ws.queries) == ws.otherChangeAfter && !ws.otherChanged {
+			ws.changes++
+			ws.otherChanged = true
+		}
+		io.WriteString(w, workflowForm(ws.status, ws.resolution, ws.deltaTS()))
+	case "/process_bug.cgi":
+		r.ParseForm()
+		ws.queries = append(ws.queries, r.Form)
+		ws.status = r.Form.Get("bug_status")
+		ws.resolution = r.Form.Get("resolution")
+		ws.changes++
+		io.WriteString(w, changesSubmitted)
+	default:
+		http.Error(w, "Unimplemented", 500)
+	}
+}
+
+func (cs *clientSuite) TestGetWorkflow(c *C) {
+	ws := &workflowServer{}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	workflow, err := bz.GetWorkflow()
+	c.Assert(err, IsNil)
+	c.Check(workflow.Statuses, DeepEquals, []string{"NEW", "IN_PROGRESS", "REOPENED", "RESOLVED", "VERIFIED"})
+	c.Check(workflow.IsOpen("NEW"), Equals, true)
+	c.Check(workflow.IsOpen("RESOLVED"), Equals, false)
+	transition, ok := workflow.CanChange("IN_PROGRESS", "RESOLVED")
+	c.Check(ok, Equals, true)
+	c.Check(transition.CommentRequired, Equals, true)
+	_, ok = workflow.CanChange("NEW", "RESOLVED")
+	c.Check(ok, Equals, false)
+	_, ok = workflow.CanChange("", "NEW")
+	c.Check(ok, Equals, true)
+
+	path, err := workflow.Path("NEW", "RESOLVED")
+	c.Assert(err, IsNil)
+	c.Check(path, DeepEquals, []bugzilla.Transition{{To: "IN_PROGRESS"}, {To: "RESOLVED", CommentRequired: true}})
+	path, err = workflow.Path("NEW", "NEW")
+	c.Assert(err, IsNil)
+	c.Check(path, HasLen, 0)
+	_, err = workflow.Path("NEW", "ASSIGNED")
+	c.Check(err, ErrorMatches, ".*no transition path from NEW to ASSIGNED.*")
+}
+
+func (cs *clientSuite) TestResolveMultipleSteps(c *C) {
+	ws := &workflowServer{status: "NEW"}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	err := bz.Resolve(1047068, "FIXED", "")
+	c.Assert(err, ErrorMatches, ".*comment is required to change the status to RESOLVED.*")
+	c.Assert(ws.queries, HasLen, 0)
+
+	err = bz.Resolve(1047068, "FIXED", "fixed in the latest update")
+	c.Assert(err, IsNil)
+	c.Assert(ws.queries, HasLen, 2)
+	c.Check(ws.queries[0].Get("bug_status"), Equals, "IN_PROGRESS")
+	c.Check(ws.queries[0].Get("comment"), Equals, "")
+	c.Check(ws.queries[1].Get("bug_status"), Equals, "RESOLVED")
+	c.Check(ws.queries[1].Get("resolution"), Equals, "FIXED")
+	c.Check(ws.queries[1].Get("comment"), Equals, "fixed in the latest update")
+	c.Check(ws.status, Equals, "RESOLVED")
+}
+
+func (cs *clientSuite) TestResolveCollision(c *C) {
+	// someone else changes the bug after the first step
+	ws := &workflowServer{status: "NEW", otherChangeAfter: 1}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	err := bz.Resolve(1047068, "FIXED", "fixed in the latest update")
+	c.Assert(err, ErrorMatches, "bug 1047068 left in status IN_PROGRESS: .*likely mid-air collision.*")
+	statusErr, ok := err.(bugzilla.StatusChangeError)
+	c.Assert(ok, Equals, true)
+	c.Check(statusErr.Status, Equals, "IN_PROGRESS")
+	c.Check(ws.queries, HasLen, 1)
+	c.Check(ws.status, Equals, "IN_PROGRESS")
+
+	// the resolution needed by a closed status is checked before changing
+	// anything
+	ws = &workflowServer{status: "RESOLVED"}
+	ts1 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts1.Close()
+	err = makeClient(ts1.URL).Verify(1047068)
+	c.Assert(err, ErrorMatches, ".*a resolution is required to change the status to VERIFIED.*")
+	c.Check(ws.queries, HasLen, 0)
+}
+
+func (cs *clientSuite) TestReopenAndVerify(c *C) {
+	ws := &workflowServer{status: "RESOLVED", resolution: "FIXED"}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	err := bz.Verify(1047068)
+	c.Assert(err, IsNil)
+	c.Assert(ws.queries, HasLen, 1)
+	c.Check(ws.queries[0].Get("bug_status"), Equals, "VERIFIED")
+	c.Check(ws.queries[0].Get("resolution"), Equals, "FIXED")
+
+	err = bz.Reopen(1047068, "")
+	c.Assert(err, ErrorMatches, ".*comment is required.*")
+
+	err = bz.Reopen(1047068, "still broken")
+	c.Assert(err, IsNil)
+	c.Assert(ws.queries, HasLen, 2)
+	c.Check(ws.queries[1].Get("bug_status"), Equals, "REOPENED")
+	c.Check(ws.queries[1].Get("comment"), Equals, "still broken")
+
+	// already open
+	err = bz.Reopen(1047068, "still broken")
+	c.Assert(err, IsNil)
+	c.Check(ws.queries, HasLen, 2)
+}
+
+func (cs *clientSuite) TestUpdateChecksWorkflow(c *C) {
+	ws := &workflowServer{status: "IN_PROGRESS"}
+	ts0 := httptest.NewServer(http.HandlerFunc(ws.handle))
+	defer ts0.Close()
+
+	bz := makeClient(ts0.URL)
+	_, err := bz.GetWorkflow()
+	c.Assert(err, IsNil)
+
+	_, err = bz.Update(1047068, bugzilla.Changes{SetStatus: "VERIFIED"})
+	c.Check(err, ErrorMatches, ".*cannot change the status from IN_PROGRESS to VERIFIED.*")
+	_, err = bz.Update(1047068, bugzilla.Changes{SetStatus: "RESOLVED", SetResolution: "FIXED"})
+	c.Check(err, ErrorMatches, ".*comment is required.*")
+	_, err = bz.Update(1047068, bugzilla.Changes{SetStatus: "RESOLVED", AddComment: "done"})
+	c.Check(err, ErrorMatches, ".*resolution is required.*")
+	_, err = bz.Update(1047068, bugzilla.Changes{SetResolution: "WORKSFORME"})
+	c.Check(err, ErrorMatches, ".*invalid resolution value: WORKSFORME.*")
+	c.Check(ws.queries, HasLen, 0)
+
+	_, err = bz.Update(1047068, bugzilla.Changes{SetStatus: "NEW"})
+	c.Check(err, IsNil)
+	c.Check(ws.queries, HasLen, 1)
+}
@@ -5,7 +5,6 @@ go 1.15
 require (
 	github.com/PuerkitoBio/goquery v1.6.1
 	github.com/andybalholm/cascadia v1.2.0
-	github.com/headzoo/surf v1.0.1-0.20180909134844-a4a8c16c01dc
 	github.com/kr/pretty v0.2.1
 	github.com/kr/text v0.2.0
 	golang.org/x/net v0.0.0-20210326060303-6b1517762897